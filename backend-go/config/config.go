@@ -6,6 +6,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
@@ -22,17 +23,28 @@ type Config struct {
 
 	DeliveryMode   string
 	EdgeRootDomain string
+	RoutingBackend string
 
 	B2KeyID      string
 	B2AppKey     string
 	B2BucketID   string
 	B2BucketName string
 
+	StorageBackend  string
+	StorageLocalDir string
+	S3Endpoint      string
+	S3Region        string
+	S3Bucket        string
+	S3AccessKey     string
+	S3SecretKey     string
+	S3PathStyle     bool
+
 	CFAPIToken   string
 	CFAccountID  string
 	CFZoneID     string
 	CFKVNSRoutes string
 	CFKVNSFBound string
+	CFKVNSID     string
 
 	GitHubClientID     string
 	GitHubClientSecret string
@@ -44,6 +56,25 @@ type Config struct {
 
 	RateAPIV1WindowMs int
 	RateAPIV1Max      int
+
+	RateDeployHookWindowMs int
+	RateDeployHookMax      int
+
+	BuildMaxConcurrent int
+	BuildMaxPerUser    int
+
+	BuildSandbox        string
+	BuildTimeoutSeconds int
+	BuildMemoryMB       int
+	BuildCPUSeconds     int
+	BuildMaxPids        int
+	BuildMaxOutputBytes int
+	BuildNetwork        bool
+
+	RetentionKeepDeployments int
+	RetentionIntervalMinutes int
+
+	NotifyThrottleMinutes int
 }
 
 func Load() *Config {
@@ -59,17 +90,28 @@ func Load() *Config {
 
 		DeliveryMode:   strings.ToLower(getEnv("FSD_DELIVERY", "")),
 		EdgeRootDomain: strings.ToLower(strings.TrimSpace(getEnv("FSD_EDGE_ROOT_DOMAIN", ""))),
+		RoutingBackend: strings.ToLower(getEnv("ROUTING_BACKEND", defaultRoutingBackend())),
 
 		B2KeyID:      getEnv("B2_KEY_ID", ""),
 		B2AppKey:     getEnv("B2_APP_KEY", ""),
 		B2BucketID:   getEnv("B2_BUCKET_ID", ""),
 		B2BucketName: getEnv("B2_BUCKET_NAME", ""),
 
+		StorageBackend:  strings.ToLower(getEnv("STORAGE_BACKEND", "b2")),
+		StorageLocalDir: getEnv("STORAGE_LOCAL_DIR", filepath.Join(getEnv("FSD_DATA_DIR", ".fsd"), "storage")),
+		S3Endpoint:      getEnv("S3_ENDPOINT", ""),
+		S3Region:        getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:        getEnv("S3_BUCKET", ""),
+		S3AccessKey:     getEnv("S3_ACCESS_KEY_ID", ""),
+		S3SecretKey:     getEnv("S3_SECRET_ACCESS_KEY", ""),
+		S3PathStyle:     getEnvBool("S3_FORCE_PATH_STYLE", false),
+
 		CFAPIToken:   getEnv("CF_API_TOKEN", ""),
 		CFAccountID:  getEnv("CF_ACCOUNT_ID", ""),
 		CFZoneID:     getEnv("CF_ZONE_ID", ""),
 		CFKVNSRoutes: getEnv("CF_KV_NS_ROUTES", ""),
 		CFKVNSFBound: getEnv("CF_KV_NS_FBOUND", ""),
+		CFKVNSID:     getEnv("CF_KV_NAMESPACE_ID", ""),
 
 		GitHubClientID:     getEnv("GITHUB_CLIENT_ID", ""),
 		GitHubClientSecret: getEnv("GITHUB_CLIENT_SECRET", ""),
@@ -81,6 +123,25 @@ func Load() *Config {
 
 		RateAPIV1WindowMs: getEnvInt("RATE_API_V1_WINDOW_MS", 15*60*1000),
 		RateAPIV1Max:      getEnvInt("RATE_API_V1_MAX", 100),
+
+		RateDeployHookWindowMs: getEnvInt("RATE_DEPLOY_HOOK_WINDOW_MS", 60*1000),
+		RateDeployHookMax:      getEnvInt("RATE_DEPLOY_HOOK_MAX", 5),
+
+		BuildMaxConcurrent: getEnvInt("BUILD_MAX_CONCURRENT", 4),
+		BuildMaxPerUser:    getEnvInt("BUILD_MAX_PER_USER", 2),
+
+		BuildSandbox:        strings.ToLower(getEnv("BUILD_SANDBOX", defaultBuildSandbox())),
+		BuildTimeoutSeconds: getEnvInt("BUILD_TIMEOUT_SECONDS", 30*60),
+		BuildMemoryMB:       getEnvInt("BUILD_MEMORY_MB", 4096),
+		BuildCPUSeconds:     getEnvInt("BUILD_CPU_SECONDS", 0),
+		BuildMaxPids:        getEnvInt("BUILD_MAX_PIDS", 512),
+		BuildMaxOutputBytes: getEnvInt("BUILD_MAX_OUTPUT_BYTES", 10*1024*1024),
+		BuildNetwork:        getEnvBool("BUILD_NETWORK", true),
+
+		RetentionKeepDeployments: getEnvInt("RETENTION_KEEP_DEPLOYMENTS", 0),
+		RetentionIntervalMinutes: getEnvInt("RETENTION_INTERVAL_MINUTES", 60),
+
+		NotifyThrottleMinutes: getEnvInt("NOTIFY_THROTTLE_MINUTES", 60),
 	}
 }
 
@@ -92,6 +153,24 @@ func (c *Config) EdgeEnabled() bool {
 	return c.DeliveryMode == "edge" && c.EdgeRootDomain != ""
 }
 
+func (c *Config) SelfDeliveryEnabled() bool {
+	return c.DeliveryMode == "self" && c.EdgeRootDomain != ""
+}
+
+func defaultBuildSandbox() string {
+	if os.Getenv("NODE_ENV") == "production" {
+		return "bwrap"
+	}
+	return "unsafe-local"
+}
+
+func defaultRoutingBackend() string {
+	if strings.ToLower(os.Getenv("FSD_DELIVERY")) == "self" {
+		return "sqlite"
+	}
+	return "cloudflare"
+}
+
 func getEnv(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -35,7 +35,7 @@ func GetDB(dbPath string) (*sql.DB, error) {
 			path = filepath.Join(dataDir, "data.sqlite")
 		}
 
-		db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_foreign_keys=on")
+		db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_foreign_keys=on&_busy_timeout=5000")
 		if err != nil {
 			initErr = err
 			return
@@ -82,6 +82,8 @@ func initSchema(db *sql.DB) error {
 		outputDir TEXT,
 		createdAt TEXT,
 		currentDeploymentId TEXT,
+		previewsEnabled INTEGER NOT NULL DEFAULT 0,
+		secretEnvKeys TEXT,
 		FOREIGN KEY(userId) REFERENCES users(id) ON DELETE CASCADE
 	);
 
@@ -102,10 +104,183 @@ func initSchema(db *sql.DB) error {
 		commitMessage TEXT,
 		commitAuthor TEXT,
 		commitAvatar TEXT,
+		outputDir TEXT,
+		pinned INTEGER NOT NULL DEFAULT 0,
+		previewId TEXT,
+		FOREIGN KEY(userId) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY(siteId) REFERENCES sites(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS deploymentJobs (
+		deploymentId TEXT PRIMARY KEY,
+		siteId TEXT,
+		userId TEXT,
+		state TEXT NOT NULL DEFAULT 'queued',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		workerId TEXT,
+		error TEXT,
+		createdAt TEXT,
+		claimedAt TEXT,
+		updatedAt TEXT,
+		FOREIGN KEY(deploymentId) REFERENCES deployments(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_deploymentJobs_state ON deploymentJobs(state, createdAt);
+
+	CREATE TABLE IF NOT EXISTS deploymentFiles (
+		deploymentId TEXT NOT NULL,
+		path TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		hash TEXT NOT NULL,
+		contentType TEXT,
+		encodings TEXT,
+		PRIMARY KEY(deploymentId, path),
+		FOREIGN KEY(deploymentId) REFERENCES deployments(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_deploymentFiles_hash ON deploymentFiles(hash);
+
+	CREATE TABLE IF NOT EXISTS deploymentRollbacks (
+		id TEXT PRIMARY KEY,
+		siteId TEXT NOT NULL,
+		fromDeploymentId TEXT,
+		toDeploymentId TEXT NOT NULL,
+		actorId TEXT,
+		via TEXT,
+		createdAt TEXT,
+		FOREIGN KEY(siteId) REFERENCES sites(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_deploymentRollbacks_siteId ON deploymentRollbacks(siteId, createdAt);
+
+	CREATE TABLE IF NOT EXISTS sitePreviews (
+		id TEXT PRIMARY KEY,
+		siteId TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		branch TEXT NOT NULL,
+		prNumber INTEGER,
+		host TEXT NOT NULL UNIQUE,
+		deploymentId TEXT,
+		createdAt TEXT,
+		updatedAt TEXT,
+		FOREIGN KEY(siteId) REFERENCES sites(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_sitePreviews_siteId ON sitePreviews(siteId);
+
+	CREATE TABLE IF NOT EXISTS deployHooks (
+		id TEXT PRIMARY KEY,
+		siteId TEXT NOT NULL,
+		userId TEXT NOT NULL,
+		name TEXT NOT NULL,
+		tokenHash TEXT NOT NULL UNIQUE,
+		tokenPrefix TEXT NOT NULL,
+		createdAt TEXT,
+		lastTriggeredAt TEXT,
+		FOREIGN KEY(siteId) REFERENCES sites(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_deployHooks_siteId ON deployHooks(siteId);
+
+	CREATE TABLE IF NOT EXISTS deployHookTriggers (
+		id TEXT PRIMARY KEY,
+		hookId TEXT NOT NULL,
+		deploymentId TEXT,
+		ref TEXT,
+		source TEXT,
+		userAgent TEXT,
+		status TEXT NOT NULL,
+		error TEXT,
+		createdAt TEXT,
+		FOREIGN KEY(hookId) REFERENCES deployHooks(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_deployHookTriggers_hookId ON deployHookTriggers(hookId, createdAt);
+
+	CREATE TABLE IF NOT EXISTS webhookEndpoints (
+		id TEXT PRIMARY KEY,
+		userId TEXT NOT NULL,
+		siteId TEXT,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL DEFAULT '',
+		enabled INTEGER NOT NULL DEFAULT 1,
+		createdAt TEXT,
 		FOREIGN KEY(userId) REFERENCES users(id) ON DELETE CASCADE,
 		FOREIGN KEY(siteId) REFERENCES sites(id) ON DELETE CASCADE
 	);
 
+	CREATE INDEX IF NOT EXISTS idx_webhookEndpoints_userId ON webhookEndpoints(userId);
+
+	CREATE TABLE IF NOT EXISTS webhookDeliveries (
+		id TEXT PRIMARY KEY,
+		endpointId TEXT NOT NULL,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		nextAttemptAt TEXT,
+		lastAttemptAt TEXT,
+		responseStatus INTEGER,
+		error TEXT,
+		replayOf TEXT,
+		createdAt TEXT,
+		FOREIGN KEY(endpointId) REFERENCES webhookEndpoints(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_webhookDeliveries_due ON webhookDeliveries(status, nextAttemptAt);
+	CREATE INDEX IF NOT EXISTS idx_webhookDeliveries_endpointId ON webhookDeliveries(endpointId, createdAt);
+
+	CREATE TABLE IF NOT EXISTS notificationSettings (
+		userId TEXT PRIMARY KEY,
+		events TEXT NOT NULL,
+		emailEnabled INTEGER NOT NULL DEFAULT 1,
+		discordWebhookUrl TEXT,
+		slackWebhookUrl TEXT,
+		webhookUrl TEXT,
+		updatedAt TEXT,
+		FOREIGN KEY(userId) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS siteNotificationState (
+		siteId TEXT PRIMARY KEY,
+		failing INTEGER NOT NULL DEFAULT 0,
+		failures INTEGER NOT NULL DEFAULT 0,
+		suppressed INTEGER NOT NULL DEFAULT 0,
+		failingSince TEXT,
+		lastNotifiedAt TEXT,
+		FOREIGN KEY(siteId) REFERENCES sites(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS siteGitWebhooks (
+		siteId TEXT PRIMARY KEY,
+		secret TEXT NOT NULL,
+		createdAt TEXT,
+		lastDeliveryAt TEXT,
+		FOREIGN KEY(siteId) REFERENCES sites(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS routeHosts (
+		host TEXT PRIMARY KEY,
+		siteId TEXT NOT NULL,
+		updatedAt TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_routeHosts_siteId ON routeHosts(siteId);
+
+	CREATE TABLE IF NOT EXISTS routeDeployments (
+		siteId TEXT PRIMARY KEY,
+		deploymentId TEXT NOT NULL,
+		updatedAt TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS routePreviews (
+		host TEXT PRIMARY KEY,
+		siteId TEXT NOT NULL,
+		deploymentId TEXT NOT NULL,
+		updatedAt TEXT
+	);
+
 	CREATE TABLE IF NOT EXISTS oauthAccounts (
 		id TEXT PRIMARY KEY,
 		provider TEXT,
@@ -202,5 +377,15 @@ func initSchema(db *sql.DB) error {
 
 	db.Exec(`ALTER TABLE deployments ADD COLUMN commitAvatar TEXT`)
 
+	db.Exec(`ALTER TABLE deployments ADD COLUMN outputDir TEXT`)
+
+	db.Exec(`ALTER TABLE deployments ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0`)
+
+	db.Exec(`ALTER TABLE deployments ADD COLUMN previewId TEXT`)
+
+	db.Exec(`ALTER TABLE sites ADD COLUMN previewsEnabled INTEGER NOT NULL DEFAULT 0`)
+
+	db.Exec(`ALTER TABLE sites ADD COLUMN secretEnvKeys TEXT`)
+
 	return nil
 }
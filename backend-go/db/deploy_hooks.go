@@ -0,0 +1,171 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	HookTriggerDeployed = "deployed"
+	HookTriggerFailed   = "failed"
+
+	maxDeployHookTriggers = 100
+)
+
+type DeployHook struct {
+	ID              string  `json:"id"`
+	SiteID          string  `json:"siteId"`
+	UserID          string  `json:"-"`
+	Name            string  `json:"name"`
+	TokenPrefix     string  `json:"prefix"`
+	CreatedAt       string  `json:"createdAt"`
+	LastTriggeredAt *string `json:"lastTriggeredAt"`
+}
+
+type DeployHookTrigger struct {
+	ID           string  `json:"id"`
+	HookID       string  `json:"hookId"`
+	DeploymentID *string `json:"deploymentId"`
+	Ref          *string `json:"ref"`
+	Source       *string `json:"source"`
+	UserAgent    *string `json:"userAgent"`
+	Status       string  `json:"status"`
+	Error        *string `json:"error,omitempty"`
+	CreatedAt    string  `json:"createdAt"`
+}
+
+func HashDeployHookToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func scanDeployHook(row interface{ Scan(...interface{}) error }) (*DeployHook, error) {
+	var h DeployHook
+	var last sql.NullString
+	if err := row.Scan(&h.ID, &h.SiteID, &h.UserID, &h.Name, &h.TokenPrefix, &h.CreatedAt, &last); err != nil {
+		return nil, err
+	}
+	h.LastTriggeredAt = nullStringToPtr(last)
+	return &h, nil
+}
+
+func CreateDeployHook(db *sql.DB, id, siteID, userID, name, token string) error {
+	_, err := db.Exec(`
+		INSERT INTO deployHooks (id, siteId, userId, name, tokenHash, tokenPrefix, createdAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, id, siteID, userID, name, HashDeployHookToken(token), token[:7], time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func ListDeployHooks(db *sql.DB, siteID string) ([]DeployHook, error) {
+	rows, err := db.Query(`
+		SELECT id, siteId, userId, name, tokenPrefix, createdAt, lastTriggeredAt
+		FROM deployHooks WHERE siteId = ?
+		ORDER BY createdAt
+	`, siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []DeployHook{}
+	for rows.Next() {
+		h, err := scanDeployHook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, *h)
+	}
+	return hooks, rows.Err()
+}
+
+func GetDeployHook(db *sql.DB, siteID, id string) (*DeployHook, error) {
+	return scanDeployHook(db.QueryRow(`
+		SELECT id, siteId, userId, name, tokenPrefix, createdAt, lastTriggeredAt
+		FROM deployHooks WHERE id = ? AND siteId = ?
+	`, id, siteID))
+}
+
+func GetDeployHookByToken(db *sql.DB, token string) (*DeployHook, error) {
+	return scanDeployHook(db.QueryRow(`
+		SELECT id, siteId, userId, name, tokenPrefix, createdAt, lastTriggeredAt
+		FROM deployHooks WHERE tokenHash = ?
+	`, HashDeployHookToken(token)))
+}
+
+func RenameDeployHook(db *sql.DB, siteID, id, name string) error {
+	result, err := db.Exec(`UPDATE deployHooks SET name = ? WHERE id = ? AND siteId = ?`, name, id, siteID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func DeleteDeployHook(db *sql.DB, siteID, id string) error {
+	result, err := db.Exec(`DELETE FROM deployHooks WHERE id = ? AND siteId = ?`, id, siteID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func RecordDeployHookTrigger(db *sql.DB, id, hookID, deploymentID, ref, source, userAgent, status, errMsg string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := db.Exec(`
+		INSERT INTO deployHookTriggers (id, hookId, deploymentId, ref, source, userAgent, status, error, createdAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, hookID, toNull(deploymentID), toNull(ref), toNull(source), toNull(userAgent), status, toNull(errMsg), now)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(`UPDATE deployHooks SET lastTriggeredAt = ? WHERE id = ?`, now, hookID); err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		DELETE FROM deployHookTriggers WHERE hookId = ? AND id NOT IN (
+			SELECT id FROM deployHookTriggers WHERE hookId = ? ORDER BY createdAt DESC LIMIT ?
+		)
+	`, hookID, hookID, maxDeployHookTriggers)
+	return err
+}
+
+func ListDeployHookTriggers(db *sql.DB, hookID string, limit int) ([]DeployHookTrigger, error) {
+	rows, err := db.Query(`
+		SELECT id, hookId, deploymentId, ref, source, userAgent, status, error, createdAt
+		FROM deployHookTriggers WHERE hookId = ?
+		ORDER BY createdAt DESC
+		LIMIT ?
+	`, hookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	triggers := []DeployHookTrigger{}
+	for rows.Next() {
+		var t DeployHookTrigger
+		var deployID, ref, source, userAgent, errMsg sql.NullString
+		if err := rows.Scan(&t.ID, &t.HookID, &deployID, &ref, &source, &userAgent, &t.Status, &errMsg, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		t.DeploymentID = nullStringToPtr(deployID)
+		t.Ref = nullStringToPtr(ref)
+		t.Source = nullStringToPtr(source)
+		t.UserAgent = nullStringToPtr(userAgent)
+		t.Error = nullStringToPtr(errMsg)
+		triggers = append(triggers, t)
+	}
+	return triggers, rows.Err()
+}
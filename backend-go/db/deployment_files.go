@@ -0,0 +1,130 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package db
+
+import (
+	"database/sql"
+)
+
+type DeploymentFile struct {
+	DeploymentID string
+	Path         string
+	Size         int64
+	Hash         string
+	ContentType  string
+	Encodings    string
+}
+
+func SaveDeploymentFiles(db *sql.DB, deployID string, files []DeploymentFile) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM deploymentFiles WHERE deploymentId = ?`, deployID); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO deploymentFiles (deploymentId, path, size, hash, contentType, encodings)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, f := range files {
+		var encodings interface{}
+		if f.Encodings != "" {
+			encodings = f.Encodings
+		}
+		if _, err := stmt.Exec(deployID, f.Path, f.Size, f.Hash, f.ContentType, encodings); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func scanDeploymentFiles(rows *sql.Rows) ([]DeploymentFile, error) {
+	defer rows.Close()
+
+	var files []DeploymentFile
+	for rows.Next() {
+		var f DeploymentFile
+		var contentType, encodings sql.NullString
+		if err := rows.Scan(&f.DeploymentID, &f.Path, &f.Size, &f.Hash, &contentType, &encodings); err != nil {
+			return nil, err
+		}
+		f.ContentType = contentType.String
+		f.Encodings = encodings.String
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+func ListDeploymentFiles(db *sql.DB, deployID string) ([]DeploymentFile, error) {
+	rows, err := db.Query(`
+		SELECT deploymentId, path, size, hash, contentType, encodings
+		FROM deploymentFiles WHERE deploymentId = ? ORDER BY path
+	`, deployID)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeploymentFiles(rows)
+}
+
+func ListSiteDeploymentFiles(db *sql.DB, siteID string) ([]DeploymentFile, error) {
+	rows, err := db.Query(`
+		SELECT f.deploymentId, f.path, f.size, f.hash, f.contentType, f.encodings
+		FROM deploymentFiles f
+		JOIN deployments d ON d.id = f.deploymentId
+		WHERE d.siteId = ?
+	`, siteID)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeploymentFiles(rows)
+}
+
+// ListUploadedSiteFiles returns the files of every deployment of a site whose
+// upload finished, so their blobs are known to exist in storage.
+func ListUploadedSiteFiles(db *sql.DB, siteID, excludeDeployID string) ([]DeploymentFile, error) {
+	rows, err := db.Query(`
+		SELECT f.deploymentId, f.path, f.size, f.hash, f.contentType, f.encodings
+		FROM deploymentFiles f
+		JOIN deployments d ON d.id = f.deploymentId
+		JOIN deploymentJobs j ON j.deploymentId = f.deploymentId
+		WHERE d.siteId = ? AND f.deploymentId != ? AND j.state IN (?, ?)
+	`, siteID, excludeDeployID, JobRouting, JobDone)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeploymentFiles(rows)
+}
+
+func ListDeploymentsWithoutFiles(db *sql.DB, siteID string) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT d.id FROM deployments d
+		WHERE d.siteId = ?
+		AND NOT EXISTS (SELECT 1 FROM deploymentFiles f WHERE f.deploymentId = d.id)
+	`, siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -21,6 +21,9 @@ type Deployment struct {
 	CommitAuthor  sql.NullString
 	CommitAvatar  sql.NullString
 	LogsPath      sql.NullString
+	OutputDir     sql.NullString
+	Pinned        bool
+	PreviewID     sql.NullString
 }
 
 type DeploymentResponse struct {
@@ -32,6 +35,10 @@ type DeploymentResponse struct {
 	CommitMessage *string `json:"commitMessage"`
 	CommitAuthor  *string `json:"commitAuthor"`
 	CommitAvatar  *string `json:"commitAvatar"`
+	OutputDir     *string `json:"outputDir,omitempty"`
+	QueuePosition *int    `json:"queuePosition,omitempty"`
+	Pinned        bool    `json:"pinned"`
+	PreviewID     *string `json:"previewId,omitempty"`
 }
 
 func (d *Deployment) ToResponse() DeploymentResponse {
@@ -39,6 +46,7 @@ func (d *Deployment) ToResponse() DeploymentResponse {
 		ID:        d.ID,
 		Status:    d.Status,
 		CreatedAt: d.CreatedAt,
+		Pinned:    d.Pinned,
 	}
 	if d.URL.Valid {
 		resp.URL = &d.URL.String
@@ -55,9 +63,24 @@ func (d *Deployment) ToResponse() DeploymentResponse {
 	if d.CommitAvatar.Valid {
 		resp.CommitAvatar = &d.CommitAvatar.String
 	}
+	if d.OutputDir.Valid {
+		resp.OutputDir = &d.OutputDir.String
+	}
+	if d.PreviewID.Valid {
+		resp.PreviewID = &d.PreviewID.String
+	}
 	return resp
 }
 
+func (r *DeploymentResponse) SetQueuePosition(positions map[string]int) {
+	if r.Status != "queued" {
+		return
+	}
+	if pos, ok := positions[r.ID]; ok {
+		r.QueuePosition = &pos
+	}
+}
+
 func CreateDeployment(db *sql.DB, id, userID, siteID, status string, commitSha, commitMessage, commitAuthor, commitAvatar *string) error {
 	_, err := db.Exec(`
 		INSERT INTO deployments (id, userId, siteId, createdAt, status, commitSha, commitMessage, commitAuthor, commitAvatar)
@@ -80,11 +103,16 @@ func UpdateDeploymentLogs(db *sql.DB, id, logsPath string) error {
 	return err
 }
 
+func UpdateDeploymentOutputDir(db *sql.DB, id, outputDir string) error {
+	_, err := db.Exec(`UPDATE deployments SET outputDir = ? WHERE id = ?`, outputDir, id)
+	return err
+}
+
 func StopOtherDeployments(db *sql.DB, siteID, currentDeployID string) error {
 	_, err := db.Exec(`
 		UPDATE deployments 
 		SET status = 'stopped' 
-		WHERE siteId = ? AND id != ? AND status = 'running'
+		WHERE siteId = ? AND id != ? AND status = 'running' AND previewId IS NULL
 	`, siteID, currentDeployID)
 	return err
 }
@@ -92,10 +120,10 @@ func StopOtherDeployments(db *sql.DB, siteID, currentDeployID string) error {
 func GetDeploymentByID(db *sql.DB, id string) (*Deployment, error) {
 	var d Deployment
 	err := db.QueryRow(`
-		SELECT id, userId, siteId, createdAt, status, url, commitSha, commitMessage, commitAuthor, commitAvatar, logsPath
+		SELECT id, userId, siteId, createdAt, status, url, commitSha, commitMessage, commitAuthor, commitAvatar, logsPath, outputDir, pinned, previewId
 		FROM deployments WHERE id = ?
 	`, id).Scan(&d.ID, &d.UserID, &d.SiteID, &d.CreatedAt, &d.Status,
-		&d.URL, &d.CommitSha, &d.CommitMessage, &d.CommitAuthor, &d.CommitAvatar, &d.LogsPath)
+		&d.URL, &d.CommitSha, &d.CommitMessage, &d.CommitAuthor, &d.CommitAvatar, &d.LogsPath, &d.OutputDir, &d.Pinned, &d.PreviewID)
 	if err != nil {
 		return nil, err
 	}
@@ -104,7 +132,7 @@ func GetDeploymentByID(db *sql.DB, id string) (*Deployment, error) {
 
 func ListDeployments(db *sql.DB, userID, siteID string) ([]Deployment, error) {
 	rows, err := db.Query(`
-		SELECT id, userId, siteId, createdAt, status, url, commitSha, commitMessage, commitAuthor, commitAvatar, logsPath
+		SELECT id, userId, siteId, createdAt, status, url, commitSha, commitMessage, commitAuthor, commitAvatar, logsPath, outputDir, pinned, previewId
 		FROM deployments WHERE userId = ? AND siteId = ?
 		ORDER BY createdAt DESC
 	`, userID, siteID)
@@ -117,7 +145,7 @@ func ListDeployments(db *sql.DB, userID, siteID string) ([]Deployment, error) {
 	for rows.Next() {
 		var d Deployment
 		if err := rows.Scan(&d.ID, &d.UserID, &d.SiteID, &d.CreatedAt, &d.Status,
-			&d.URL, &d.CommitSha, &d.CommitMessage, &d.CommitAuthor, &d.CommitAvatar, &d.LogsPath); err != nil {
+			&d.URL, &d.CommitSha, &d.CommitMessage, &d.CommitAuthor, &d.CommitAvatar, &d.LogsPath, &d.OutputDir, &d.Pinned, &d.PreviewID); err != nil {
 			return nil, err
 		}
 		deps = append(deps, d)
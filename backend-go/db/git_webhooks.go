@@ -0,0 +1,57 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+type SiteGitWebhook struct {
+	SiteID         string
+	Secret         string
+	CreatedAt      string
+	LastDeliveryAt *string
+}
+
+func GetSiteGitWebhook(db *sql.DB, siteID string) (*SiteGitWebhook, error) {
+	var hook SiteGitWebhook
+	var last sql.NullString
+	err := db.QueryRow(`
+		SELECT siteId, secret, createdAt, lastDeliveryAt FROM siteGitWebhooks WHERE siteId = ?
+	`, siteID).Scan(&hook.SiteID, &hook.Secret, &hook.CreatedAt, &last)
+	if err != nil {
+		return nil, err
+	}
+	hook.LastDeliveryAt = nullStringToPtr(last)
+	return &hook, nil
+}
+
+func SetSiteGitWebhookSecret(db *sql.DB, siteID, secret string) error {
+	_, err := db.Exec(`
+		INSERT INTO siteGitWebhooks (siteId, secret, createdAt) VALUES (?, ?, ?)
+		ON CONFLICT(siteId) DO UPDATE SET secret = excluded.secret, createdAt = excluded.createdAt, lastDeliveryAt = NULL
+	`, siteID, secret, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func DeleteSiteGitWebhook(db *sql.DB, siteID string) error {
+	_, err := db.Exec(`DELETE FROM siteGitWebhooks WHERE siteId = ?`, siteID)
+	return err
+}
+
+func TouchSiteGitWebhook(db *sql.DB, siteID string) error {
+	_, err := db.Exec(`UPDATE siteGitWebhooks SET lastDeliveryAt = ? WHERE siteId = ?`,
+		time.Now().UTC().Format(time.RFC3339), siteID)
+	return err
+}
+
+func SetDeploymentCommitIfMissing(db *sql.DB, deployID, sha, message, author string) error {
+	_, err := db.Exec(`
+		UPDATE deployments SET commitSha = ?, commitMessage = ?, commitAuthor = ?
+		WHERE id = ? AND (commitSha IS NULL OR commitSha = '')
+	`, toNull(sha), toNull(message), toNull(author), deployID)
+	return err
+}
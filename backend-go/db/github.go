@@ -79,7 +79,7 @@ func GetSitesByRepo(db *sql.DB, repoURL, branch string) ([]Site, error) {
 		if s.GitBranch.Valid && s.GitBranch.String != "" {
 			siteBranch = s.GitBranch.String
 		}
-		if siteBranch != targetBranch {
+		if targetBranch != "" && siteBranch != targetBranch {
 			continue
 		}
 
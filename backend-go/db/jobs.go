@@ -0,0 +1,399 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	JobQueued     = "queued"
+	JobCloning    = "cloning"
+	JobBuilding   = "building"
+	JobUploading  = "uploading"
+	JobRouting    = "routing"
+	JobDone       = "done"
+	JobFailed     = "failed"
+	JobCanceled   = "canceled"
+	JobSuperseded = "superseded"
+)
+
+const jobTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+var activeJobStates = []string{JobCloning, JobBuilding, JobUploading, JobRouting}
+
+type DeploymentJob struct {
+	DeploymentID string
+	SiteID       string
+	UserID       string
+	State        string
+	Attempts     int
+	WorkerID     sql.NullString
+	Error        sql.NullString
+	CreatedAt    string
+	ClaimedAt    sql.NullString
+	UpdatedAt    sql.NullString
+}
+
+func (j *DeploymentJob) InProgress() bool {
+	if j.State == JobQueued {
+		return true
+	}
+	for _, state := range activeJobStates {
+		if j.State == state {
+			return true
+		}
+	}
+	return false
+}
+
+func CreateDeploymentJob(db *sql.DB, deployID, siteID, userID string) error {
+	now := time.Now().UTC().Format(jobTimeFormat)
+	_, err := db.Exec(`
+		INSERT INTO deploymentJobs (deploymentId, siteId, userId, state, attempts, createdAt, updatedAt)
+		VALUES (?, ?, ?, ?, 0, ?, ?)
+	`, deployID, siteID, userID, JobQueued, now, now)
+	return err
+}
+
+func ClaimDeploymentJob(db *sql.DB, workerID string, maxPerUser int) (*DeploymentJob, error) {
+	now := time.Now().UTC().Format(jobTimeFormat)
+	if maxPerUser <= 0 {
+		maxPerUser = -1
+	}
+
+	var j DeploymentJob
+	err := db.QueryRow(`
+		UPDATE deploymentJobs
+		SET state = ?, attempts = attempts + 1, workerId = ?, claimedAt = ?, updatedAt = ?
+		WHERE deploymentId = (
+			SELECT q.deploymentId FROM deploymentJobs q
+			WHERE q.state = ?
+			AND NOT EXISTS (
+				SELECT 1 FROM deploymentJobs s
+				WHERE s.siteId = q.siteId AND s.state IN (?, ?, ?, ?)
+			)
+			AND (? < 0 OR (
+				SELECT COUNT(*) FROM deploymentJobs a
+				WHERE a.userId = q.userId AND a.state IN (?, ?, ?, ?)
+			) < ?)
+			ORDER BY (
+				SELECT MAX(c.claimedAt) FROM deploymentJobs c WHERE c.userId = q.userId
+			) ASC, q.createdAt ASC, q.rowid ASC
+			LIMIT 1
+		) AND state = ?
+		RETURNING deploymentId, siteId, userId, state, attempts, workerId, error, createdAt, claimedAt, updatedAt
+	`, JobCloning, workerID, now, now,
+		JobQueued,
+		activeJobStates[0], activeJobStates[1], activeJobStates[2], activeJobStates[3],
+		maxPerUser, activeJobStates[0], activeJobStates[1], activeJobStates[2], activeJobStates[3], maxPerUser,
+		JobQueued).Scan(&j.DeploymentID, &j.SiteID, &j.UserID, &j.State,
+		&j.Attempts, &j.WorkerID, &j.Error, &j.CreatedAt, &j.ClaimedAt, &j.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// QueuePositions replays ClaimDeploymentJob over the queue: a site builds
+// one job at a time, a user runs at most maxPerUser jobs, and the user served
+// least recently goes first. When nothing is eligible, the oldest running job
+// is assumed to finish next.
+func QueuePositions(db *sql.DB, maxPerUser int) (map[string]int, error) {
+	type queuedJob struct {
+		deployID, siteID, userID string
+	}
+	type runningJob struct {
+		siteID, userID string
+	}
+	type userTurn struct {
+		turn   int
+		served string
+	}
+
+	rows, err := db.Query(`
+		SELECT q.deploymentId, q.siteId, q.userId, q.state,
+		       (SELECT MAX(c.claimedAt) FROM deploymentJobs c WHERE c.userId = q.userId)
+		FROM deploymentJobs q
+		WHERE q.state IN (?, ?, ?, ?, ?)
+		ORDER BY q.state = ? ASC, q.claimedAt ASC, q.createdAt ASC, q.rowid ASC
+	`, JobQueued, activeJobStates[0], activeJobStates[1], activeJobStates[2], activeJobStates[3], JobQueued)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var queue []queuedJob
+	var running []runningJob
+	turns := map[string]userTurn{}
+	for rows.Next() {
+		var j queuedJob
+		var state string
+		var served sql.NullString
+		if err := rows.Scan(&j.deployID, &j.siteID, &j.userID, &state, &served); err != nil {
+			return nil, err
+		}
+		turns[j.userID] = userTurn{served: served.String}
+		if state == JobQueued {
+			queue = append(queue, j)
+		} else {
+			running = append(running, runningJob{j.siteID, j.userID})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	busySites := map[string]int{}
+	userRunning := map[string]int{}
+	for _, r := range running {
+		busySites[r.siteID]++
+		userRunning[r.userID]++
+	}
+
+	before := func(a, b userTurn) bool {
+		if a.turn != b.turn {
+			return a.turn < b.turn
+		}
+		return a.served < b.served
+	}
+
+	positions := map[string]int{}
+	turn := 0
+	for len(queue) > 0 {
+		next := -1
+		for i, j := range queue {
+			if busySites[j.siteID] > 0 || (maxPerUser > 0 && userRunning[j.userID] >= maxPerUser) {
+				continue
+			}
+			if next < 0 || before(turns[j.userID], turns[queue[next].userID]) {
+				next = i
+			}
+		}
+
+		if next < 0 {
+			if len(running) == 0 {
+				break
+			}
+			done := running[0]
+			running = running[1:]
+			busySites[done.siteID]--
+			userRunning[done.userID]--
+			continue
+		}
+
+		j := queue[next]
+		queue = append(queue[:next], queue[next+1:]...)
+		turn++
+		positions[j.deployID] = turn
+		turns[j.userID] = userTurn{turn: turn}
+		running = append(running, runningJob{j.siteID, j.userID})
+		busySites[j.siteID]++
+		userRunning[j.userID]++
+	}
+
+	return positions, nil
+}
+
+func GetDeploymentJob(db *sql.DB, deployID string) (*DeploymentJob, error) {
+	var j DeploymentJob
+	err := db.QueryRow(`
+		SELECT deploymentId, siteId, userId, state, attempts, workerId, error, createdAt, claimedAt, updatedAt
+		FROM deploymentJobs WHERE deploymentId = ?
+	`, deployID).Scan(&j.DeploymentID, &j.SiteID, &j.UserID, &j.State,
+		&j.Attempts, &j.WorkerID, &j.Error, &j.CreatedAt, &j.ClaimedAt, &j.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+func UpdateDeploymentJobState(db *sql.DB, deployID, state string) error {
+	_, err := db.Exec(`UPDATE deploymentJobs SET state = ?, updatedAt = ? WHERE deploymentId = ?`,
+		state, time.Now().UTC().Format(jobTimeFormat), deployID)
+	return err
+}
+
+func FinishDeploymentJob(db *sql.DB, deployID, state, errMsg string) error {
+	_, err := db.Exec(`UPDATE deploymentJobs SET state = ?, error = ?, updatedAt = ? WHERE deploymentId = ?`,
+		state, toNull(errMsg), time.Now().UTC().Format(jobTimeFormat), deployID)
+	return err
+}
+
+func CancelQueuedDeploymentJob(db *sql.DB, deployID string) (bool, error) {
+	res, err := db.Exec(`UPDATE deploymentJobs SET state = ?, updatedAt = ? WHERE deploymentId = ? AND state = ?`,
+		JobCanceled, time.Now().UTC().Format(jobTimeFormat), deployID, JobQueued)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return false, nil
+	}
+	_, err = db.Exec(`UPDATE deployments SET status = 'canceled' WHERE id = ?`, deployID)
+	return true, err
+}
+
+func SupersedeQueuedJobs(db *sql.DB, siteID, previewID, exceptID string) ([]string, error) {
+	rows, err := db.Query(`
+		UPDATE deploymentJobs SET state = ?, updatedAt = ?
+		WHERE siteId = ? AND deploymentId != ? AND state = ?
+		AND deploymentId IN (SELECT id FROM deployments WHERE COALESCE(previewId, '') = ?)
+		RETURNING deploymentId
+	`, JobSuperseded, time.Now().UTC().Format(jobTimeFormat), siteID, exceptID, JobQueued, previewID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if _, err := db.Exec(`UPDATE deployments SET status = 'superseded' WHERE id = ?`, id); err != nil {
+			return ids, err
+		}
+	}
+	return ids, nil
+}
+
+func ListActiveJobsForSite(db *sql.DB, siteID, previewID, exceptID string) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT j.deploymentId FROM deploymentJobs j
+		JOIN deployments d ON d.id = j.deploymentId
+		WHERE j.siteId = ? AND j.deploymentId != ? AND j.state IN (?, ?, ?, ?)
+		AND COALESCE(d.previewId, '') = ?
+	`, siteID, exceptID, activeJobStates[0], activeJobStates[1], activeJobStates[2], activeJobStates[3], previewID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func IsOlderThanCurrentDeployment(db *sql.DB, siteID, deployID string) (bool, error) {
+	var older int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM sites s
+		JOIN deployments cur ON cur.id = s.currentDeploymentId
+		LEFT JOIN deploymentJobs curJob ON curJob.deploymentId = cur.id
+		JOIN deployments d ON d.id = ?
+		LEFT JOIN deploymentJobs dJob ON dJob.deploymentId = d.id
+		WHERE s.id = ? AND cur.id != d.id
+		AND COALESCE(curJob.createdAt, cur.createdAt) > COALESCE(dJob.createdAt, d.createdAt)
+	`, deployID, siteID).Scan(&older)
+	if err != nil {
+		return false, err
+	}
+	return older > 0, nil
+}
+
+func IsOlderThanPreviewDeployment(db *sql.DB, previewID, deployID string) (bool, error) {
+	var older int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM sitePreviews p
+		JOIN deployments cur ON cur.id = p.deploymentId
+		LEFT JOIN deploymentJobs curJob ON curJob.deploymentId = cur.id
+		JOIN deployments d ON d.id = ?
+		LEFT JOIN deploymentJobs dJob ON dJob.deploymentId = d.id
+		WHERE p.id = ? AND cur.id != d.id
+		AND COALESCE(curJob.createdAt, cur.createdAt) > COALESCE(dJob.createdAt, d.createdAt)
+	`, deployID, previewID).Scan(&older)
+	if err != nil {
+		return false, err
+	}
+	return older > 0, nil
+}
+
+func RecoverInterruptedJobs(db *sql.DB, maxAttempts int) (requeued, failed int, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(jobTimeFormat)
+
+	rows, err := tx.Query(`
+		SELECT deploymentId, attempts FROM deploymentJobs
+		WHERE state IN (?, ?, ?, ?)
+	`, activeJobStates[0], activeJobStates[1], activeJobStates[2], activeJobStates[3])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	type interrupted struct {
+		id       string
+		attempts int
+	}
+	var jobs []interrupted
+	for rows.Next() {
+		var j interrupted
+		if err := rows.Scan(&j.id, &j.attempts); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		jobs = append(jobs, j)
+	}
+	rows.Close()
+
+	for _, j := range jobs {
+		if j.attempts < maxAttempts {
+			if _, err := tx.Exec(`UPDATE deploymentJobs SET state = ?, workerId = NULL, updatedAt = ? WHERE deploymentId = ?`,
+				JobQueued, now, j.id); err != nil {
+				return 0, 0, err
+			}
+			if _, err := tx.Exec(`UPDATE deployments SET status = 'queued', url = NULL WHERE id = ?`, j.id); err != nil {
+				return 0, 0, err
+			}
+			requeued++
+			continue
+		}
+
+		if _, err := tx.Exec(`UPDATE deploymentJobs SET state = ?, error = ?, updatedAt = ? WHERE deploymentId = ?`,
+			JobFailed, "interrupted by backend restart", now, j.id); err != nil {
+			return 0, 0, err
+		}
+		if _, err := tx.Exec(`UPDATE deployments SET status = 'failed' WHERE id = ?`, j.id); err != nil {
+			return 0, 0, err
+		}
+		failed++
+	}
+
+	res, err := tx.Exec(`
+		UPDATE deployments SET status = 'failed'
+		WHERE status IN ('queued', 'building')
+		AND id NOT IN (SELECT deploymentId FROM deploymentJobs WHERE state = ?)
+	`, JobQueued)
+	if err != nil {
+		return 0, 0, err
+	}
+	orphaned, _ := res.RowsAffected()
+	failed += int(orphaned)
+
+	return requeued, failed, tx.Commit()
+}
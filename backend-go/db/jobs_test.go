@@ -0,0 +1,277 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.sqlite")
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := initSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+type testJob struct {
+	id, site, user, state string
+	claimedAt             string
+}
+
+func insertTestJobs(t *testing.T, db *sql.DB, jobs []testJob) {
+	t.Helper()
+	seen := map[string]bool{}
+	for i, j := range jobs {
+		if !seen["u:"+j.user] {
+			seen["u:"+j.user] = true
+			if _, err := db.Exec(`INSERT INTO users (id, email) VALUES (?, ?)`, j.user, j.user+"@example.com"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !seen["s:"+j.site] {
+			seen["s:"+j.site] = true
+			if _, err := db.Exec(`INSERT INTO sites (id, userId, name) VALUES (?, ?, ?)`, j.site, j.user, j.site); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := db.Exec(`INSERT INTO deployments (id, userId, siteId, status) VALUES (?, ?, ?, 'queued')`,
+			j.id, j.user, j.site); err != nil {
+			t.Fatal(err)
+		}
+		createdAt := fmt.Sprintf("2025-01-01T00:00:%02d.000000000Z", i)
+		if _, err := db.Exec(`
+			INSERT INTO deploymentJobs (deploymentId, siteId, userId, state, createdAt, claimedAt, updatedAt)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, j.id, j.site, j.user, j.state, createdAt, toNull(j.claimedAt), createdAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestClaimDeploymentJob(t *testing.T) {
+	tests := []struct {
+		name       string
+		jobs       []testJob
+		maxPerUser int
+		want       string
+	}{
+		{
+			name: "empty queue",
+			want: "",
+		},
+		{
+			name: "oldest job first",
+			jobs: []testJob{
+				{id: "d1", site: "s1", user: "u1", state: JobQueued},
+				{id: "d2", site: "s2", user: "u1", state: JobQueued},
+			},
+			want: "d1",
+		},
+		{
+			name: "site already building",
+			jobs: []testJob{
+				{id: "d1", site: "s1", user: "u1", state: JobBuilding, claimedAt: "2025-01-01T00:01:00.000000000Z"},
+				{id: "d2", site: "s1", user: "u1", state: JobQueued},
+				{id: "d3", site: "s2", user: "u1", state: JobQueued},
+			},
+			want: "d3",
+		},
+		{
+			name: "only job blocked by its site",
+			jobs: []testJob{
+				{id: "d1", site: "s1", user: "u1", state: JobUploading, claimedAt: "2025-01-01T00:01:00.000000000Z"},
+				{id: "d2", site: "s1", user: "u1", state: JobQueued},
+			},
+			want: "",
+		},
+		{
+			name: "finished jobs do not block",
+			jobs: []testJob{
+				{id: "d1", site: "s1", user: "u1", state: JobDone, claimedAt: "2025-01-01T00:01:00.000000000Z"},
+				{id: "d2", site: "s1", user: "u1", state: JobFailed, claimedAt: "2025-01-01T00:02:00.000000000Z"},
+				{id: "d3", site: "s1", user: "u1", state: JobQueued},
+			},
+			want: "d3",
+		},
+		{
+			name: "user at concurrency limit",
+			jobs: []testJob{
+				{id: "d1", site: "s1", user: "u1", state: JobBuilding, claimedAt: "2025-01-01T00:01:00.000000000Z"},
+				{id: "d2", site: "s2", user: "u1", state: JobQueued},
+				{id: "d3", site: "s3", user: "u2", state: JobQueued},
+			},
+			maxPerUser: 1,
+			want:       "d3",
+		},
+		{
+			name: "no per-user limit",
+			jobs: []testJob{
+				{id: "d1", site: "s1", user: "u1", state: JobBuilding, claimedAt: "2025-01-01T00:01:00.000000000Z"},
+				{id: "d2", site: "s2", user: "u1", state: JobQueued},
+			},
+			maxPerUser: 0,
+			want:       "d2",
+		},
+		{
+			name: "never served user goes first",
+			jobs: []testJob{
+				{id: "d1", site: "s1", user: "u1", state: JobDone, claimedAt: "2025-01-01T00:01:00.000000000Z"},
+				{id: "d2", site: "s2", user: "u1", state: JobQueued},
+				{id: "d3", site: "s3", user: "u2", state: JobQueued},
+			},
+			want: "d3",
+		},
+		{
+			name: "least recently served user goes first",
+			jobs: []testJob{
+				{id: "d1", site: "s1", user: "u1", state: JobDone, claimedAt: "2025-01-01T00:05:00.000000000Z"},
+				{id: "d2", site: "s2", user: "u2", state: JobDone, claimedAt: "2025-01-01T00:03:00.000000000Z"},
+				{id: "d3", site: "s3", user: "u1", state: JobQueued},
+				{id: "d4", site: "s4", user: "u2", state: JobQueued},
+			},
+			want: "d4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			insertTestJobs(t, db, tt.jobs)
+
+			job, err := ClaimDeploymentJob(db, "worker-1", tt.maxPerUser)
+			if tt.want == "" {
+				if !errors.Is(err, sql.ErrNoRows) {
+					t.Fatalf("ClaimDeploymentJob() = %v, %v, want sql.ErrNoRows", job, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ClaimDeploymentJob() error = %v", err)
+			}
+			if job.DeploymentID != tt.want {
+				t.Fatalf("claimed %s, want %s", job.DeploymentID, tt.want)
+			}
+			if job.State != JobCloning || job.Attempts != 1 || job.WorkerID.String != "worker-1" || !job.ClaimedAt.Valid {
+				t.Errorf("claimed job = %+v, want cloning with one attempt by worker-1", job)
+			}
+		})
+	}
+}
+
+func TestQueuePositionsMatchClaims(t *testing.T) {
+	const running = "2025-01-01T00:01:00.000000000Z"
+
+	tests := []struct {
+		name       string
+		jobs       []testJob
+		maxPerUser int
+		want       []string
+	}{
+		{
+			name: "round robin between users",
+			jobs: []testJob{
+				{id: "a1", site: "sa1", user: "ua", state: JobQueued},
+				{id: "a2", site: "sa2", user: "ua", state: JobQueued},
+				{id: "a3", site: "sa3", user: "ua", state: JobQueued},
+				{id: "b1", site: "sb1", user: "ub", state: JobQueued},
+				{id: "b2", site: "sb2", user: "ub", state: JobQueued},
+			},
+			want: []string{"a1", "b1", "a2", "b2", "a3"},
+		},
+		{
+			name: "same site waits for the running build",
+			jobs: []testJob{
+				{id: "r1", site: "sa", user: "ua", state: JobBuilding, claimedAt: running},
+				{id: "a1", site: "sa", user: "ua", state: JobQueued},
+				{id: "a2", site: "sb", user: "ua", state: JobQueued},
+			},
+			want: []string{"a2", "a1"},
+		},
+		{
+			name: "same site jobs run one after another",
+			jobs: []testJob{
+				{id: "a1", site: "sa", user: "ua", state: JobQueued},
+				{id: "a2", site: "sa", user: "ua", state: JobQueued},
+				{id: "b1", site: "sb", user: "ub", state: JobQueued},
+			},
+			want: []string{"a1", "b1", "a2"},
+		},
+		{
+			name: "user at the limit waits",
+			jobs: []testJob{
+				{id: "r1", site: "sa", user: "ua", state: JobUploading, claimedAt: running},
+				{id: "a1", site: "sb", user: "ua", state: JobQueued},
+				{id: "b1", site: "sc", user: "ub", state: JobQueued},
+				{id: "b2", site: "sd", user: "ub", state: JobQueued},
+			},
+			maxPerUser: 1,
+			want:       []string{"b1", "a1", "b2"},
+		},
+		{
+			name: "recently served user goes last",
+			jobs: []testJob{
+				{id: "d1", site: "sx", user: "ua", state: JobDone, claimedAt: running},
+				{id: "a1", site: "sa", user: "ua", state: JobQueued},
+				{id: "b1", site: "sb", user: "ub", state: JobQueued},
+			},
+			want: []string{"b1", "a1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			insertTestJobs(t, db, tt.jobs)
+
+			positions, err := QueuePositions(db, tt.maxPerUser)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, id := range tt.want {
+				if positions[id] != i+1 {
+					t.Errorf("QueuePositions()[%s] = %d, want %d", id, positions[id], i+1)
+				}
+			}
+			if len(positions) != len(tt.want) {
+				t.Errorf("QueuePositions() = %v, want %d entries", positions, len(tt.want))
+			}
+
+			// Claim in turn, finishing the oldest running job whenever nothing
+			// is eligible, and check the workers follow the reported order.
+			var active []string
+			for _, j := range tt.jobs {
+				if j.state != JobQueued && j.state != JobDone {
+					active = append(active, j.id)
+				}
+			}
+			for i, id := range tt.want {
+				job, err := ClaimDeploymentJob(db, "worker-1", tt.maxPerUser)
+				for errors.Is(err, sql.ErrNoRows) && len(active) > 0 {
+					if err := FinishDeploymentJob(db, active[0], JobDone, ""); err != nil {
+						t.Fatal(err)
+					}
+					active = active[1:]
+					job, err = ClaimDeploymentJob(db, "worker-1", tt.maxPerUser)
+				}
+				if err != nil {
+					t.Fatalf("claim %d: %v", i, err)
+				}
+				if job.DeploymentID != id {
+					t.Fatalf("claim %d = %s, want %s", i, job.DeploymentID, id)
+				}
+				active = append(active, job.DeploymentID)
+			}
+		})
+	}
+}
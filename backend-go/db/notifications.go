@@ -0,0 +1,120 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	NotifyDeploymentFailed    = "deployment.failed"
+	NotifyDeploymentRecovered = "deployment.recovered"
+)
+
+var DefaultNotificationEvents = []string{NotifyDeploymentFailed, NotifyDeploymentRecovered}
+
+type NotificationSettings struct {
+	UserID            string   `json:"-"`
+	Events            []string `json:"events"`
+	EmailEnabled      bool     `json:"emailEnabled"`
+	DiscordWebhookURL string   `json:"discordWebhookUrl"`
+	SlackWebhookURL   string   `json:"slackWebhookUrl"`
+	WebhookURL        string   `json:"webhookUrl"`
+	UpdatedAt         *string  `json:"updatedAt"`
+}
+
+func (n *NotificationSettings) Wants(event string) bool {
+	for _, e := range n.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+type SiteNotificationState struct {
+	SiteID         string
+	Failing        bool
+	Failures       int
+	Suppressed     int
+	FailingSince   sql.NullString
+	LastNotifiedAt sql.NullString
+}
+
+func GetNotificationSettings(db *sql.DB, userID string) (*NotificationSettings, error) {
+	var n NotificationSettings
+	var events string
+	var email int
+	var discord, slack, webhook, updated sql.NullString
+	err := db.QueryRow(`
+		SELECT userId, events, emailEnabled, discordWebhookUrl, slackWebhookUrl, webhookUrl, updatedAt
+		FROM notificationSettings WHERE userId = ?
+	`, userID).Scan(&n.UserID, &events, &email, &discord, &slack, &webhook, &updated)
+	if err == sql.ErrNoRows {
+		return &NotificationSettings{
+			UserID:       userID,
+			Events:       append([]string{}, DefaultNotificationEvents...),
+			EmailEnabled: true,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	n.Events = splitEvents(events)
+	n.EmailEnabled = email == 1
+	n.DiscordWebhookURL = discord.String
+	n.SlackWebhookURL = slack.String
+	n.WebhookURL = webhook.String
+	n.UpdatedAt = nullStringToPtr(updated)
+	return &n, nil
+}
+
+func SaveNotificationSettings(db *sql.DB, n *NotificationSettings) error {
+	_, err := db.Exec(`
+		INSERT INTO notificationSettings (userId, events, emailEnabled, discordWebhookUrl, slackWebhookUrl, webhookUrl, updatedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(userId) DO UPDATE SET
+			events = excluded.events,
+			emailEnabled = excluded.emailEnabled,
+			discordWebhookUrl = excluded.discordWebhookUrl,
+			slackWebhookUrl = excluded.slackWebhookUrl,
+			webhookUrl = excluded.webhookUrl,
+			updatedAt = excluded.updatedAt
+	`, n.UserID, joinEvents(n.Events), n.EmailEnabled, toNull(n.DiscordWebhookURL), toNull(n.SlackWebhookURL),
+		toNull(n.WebhookURL), time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func GetSiteNotificationState(db *sql.DB, siteID string) (*SiteNotificationState, error) {
+	s := SiteNotificationState{SiteID: siteID}
+	var failing int
+	err := db.QueryRow(`
+		SELECT failing, failures, suppressed, failingSince, lastNotifiedAt
+		FROM siteNotificationState WHERE siteId = ?
+	`, siteID).Scan(&failing, &s.Failures, &s.Suppressed, &s.FailingSince, &s.LastNotifiedAt)
+	if err == sql.ErrNoRows {
+		return &s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Failing = failing == 1
+	return &s, nil
+}
+
+func SaveSiteNotificationState(db *sql.DB, s *SiteNotificationState) error {
+	_, err := db.Exec(`
+		INSERT INTO siteNotificationState (siteId, failing, failures, suppressed, failingSince, lastNotifiedAt)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(siteId) DO UPDATE SET
+			failing = excluded.failing,
+			failures = excluded.failures,
+			suppressed = excluded.suppressed,
+			failingSince = excluded.failingSince,
+			lastNotifiedAt = excluded.lastNotifiedAt
+	`, s.SiteID, s.Failing, s.Failures, s.Suppressed, s.FailingSince, s.LastNotifiedAt)
+	return err
+}
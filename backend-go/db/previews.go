@@ -0,0 +1,154 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	PreviewBranch      = "branch"
+	PreviewPullRequest = "pr"
+)
+
+type SitePreview struct {
+	ID           string  `json:"id"`
+	SiteID       string  `json:"siteId"`
+	Kind         string  `json:"kind"`
+	Branch       string  `json:"branch"`
+	PRNumber     int     `json:"prNumber,omitempty"`
+	Host         string  `json:"host"`
+	DeploymentID *string `json:"deploymentId"`
+	CreatedAt    string  `json:"createdAt"`
+	UpdatedAt    string  `json:"updatedAt"`
+}
+
+const sitePreviewColumns = `id, siteId, kind, branch, prNumber, host, deploymentId, createdAt, updatedAt`
+
+func scanSitePreview(row interface{ Scan(...interface{}) error }) (*SitePreview, error) {
+	var p SitePreview
+	var prNumber sql.NullInt64
+	var deployID sql.NullString
+	if err := row.Scan(&p.ID, &p.SiteID, &p.Kind, &p.Branch, &prNumber, &p.Host, &deployID, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	p.PRNumber = int(prNumber.Int64)
+	p.DeploymentID = nullStringToPtr(deployID)
+	return &p, nil
+}
+
+func UpsertSitePreview(db *sql.DB, id, siteID, kind, branch string, prNumber int, host string) (*SitePreview, error) {
+	var pr sql.NullInt64
+	if prNumber > 0 {
+		pr = sql.NullInt64{Int64: int64(prNumber), Valid: true}
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	_, err := db.Exec(`
+		INSERT INTO sitePreviews (id, siteId, kind, branch, prNumber, host, createdAt, updatedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(host) DO UPDATE SET kind = excluded.kind, branch = excluded.branch,
+			prNumber = excluded.prNumber, updatedAt = excluded.updatedAt
+		WHERE sitePreviews.siteId = excluded.siteId
+	`, id, siteID, kind, branch, pr, host, now, now)
+	if err != nil {
+		return nil, err
+	}
+	return GetSitePreviewByHost(db, siteID, host)
+}
+
+func GetSitePreview(db *sql.DB, id string) (*SitePreview, error) {
+	return scanSitePreview(db.QueryRow(`SELECT `+sitePreviewColumns+` FROM sitePreviews WHERE id = ?`, id))
+}
+
+func GetSitePreviewByHost(db *sql.DB, siteID, host string) (*SitePreview, error) {
+	return scanSitePreview(db.QueryRow(`SELECT `+sitePreviewColumns+` FROM sitePreviews WHERE siteId = ? AND host = ?`, siteID, host))
+}
+
+func FindSitePreviews(db *sql.DB, siteID, kind, branch string, prNumber int) ([]SitePreview, error) {
+	rows, err := db.Query(`
+		SELECT `+sitePreviewColumns+` FROM sitePreviews
+		WHERE siteId = ? AND kind = ? AND (? = '' OR branch = ?) AND (? = 0 OR prNumber = ?)
+	`, siteID, kind, branch, branch, prNumber, prNumber)
+	if err != nil {
+		return nil, err
+	}
+	return scanSitePreviews(rows)
+}
+
+func ListSitePreviews(db *sql.DB, siteID string) ([]SitePreview, error) {
+	rows, err := db.Query(`SELECT `+sitePreviewColumns+` FROM sitePreviews WHERE siteId = ? ORDER BY updatedAt DESC`, siteID)
+	if err != nil {
+		return nil, err
+	}
+	return scanSitePreviews(rows)
+}
+
+func scanSitePreviews(rows *sql.Rows) ([]SitePreview, error) {
+	defer rows.Close()
+
+	previews := []SitePreview{}
+	for rows.Next() {
+		p, err := scanSitePreview(rows)
+		if err != nil {
+			return nil, err
+		}
+		previews = append(previews, *p)
+	}
+	return previews, rows.Err()
+}
+
+func SetSitePreviewDeployment(db *sql.DB, id, deployID string) error {
+	_, err := db.Exec(`UPDATE sitePreviews SET deploymentId = ?, updatedAt = ? WHERE id = ?`,
+		deployID, time.Now().UTC().Format(time.RFC3339), id)
+	return err
+}
+
+func DeleteSitePreview(db *sql.DB, id string) error {
+	_, err := db.Exec(`DELETE FROM sitePreviews WHERE id = ?`, id)
+	return err
+}
+
+func SetDeploymentPreview(db *sql.DB, deployID, previewID string) error {
+	_, err := db.Exec(`UPDATE deployments SET previewId = ? WHERE id = ?`, previewID, deployID)
+	return err
+}
+
+func ListPreviewDeployments(db *sql.DB, previewID string) ([]Deployment, error) {
+	rows, err := db.Query(`
+		SELECT id, userId, siteId, createdAt, status, url, commitSha, commitMessage, commitAuthor, commitAvatar, logsPath, outputDir, pinned, previewId
+		FROM deployments WHERE previewId = ?
+		ORDER BY createdAt DESC
+	`, previewID)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeployments(rows)
+}
+
+func StopOtherPreviewDeployments(db *sql.DB, previewID, currentDeployID string) error {
+	_, err := db.Exec(`
+		UPDATE deployments SET status = 'stopped'
+		WHERE previewId = ? AND id != ? AND status = 'running'
+	`, previewID, currentDeployID)
+	return err
+}
+
+func StopPreviewDeployments(db *sql.DB, previewID string) error {
+	_, err := db.Exec(`UPDATE deployments SET status = 'stopped' WHERE previewId = ? AND status = 'running'`, previewID)
+	return err
+}
+
+func GetSitePreviewsEnabled(db *sql.DB, siteID string) (bool, error) {
+	var enabled bool
+	err := db.QueryRow(`SELECT previewsEnabled FROM sites WHERE id = ?`, siteID).Scan(&enabled)
+	return enabled, err
+}
+
+func SetSitePreviewsEnabled(db *sql.DB, siteID string, enabled bool) error {
+	_, err := db.Exec(`UPDATE sites SET previewsEnabled = ? WHERE id = ?`, enabled, siteID)
+	return err
+}
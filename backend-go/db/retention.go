@@ -0,0 +1,82 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package db
+
+import (
+	"database/sql"
+)
+
+func SetDeploymentPinned(db *sql.DB, id string, pinned bool) error {
+	_, err := db.Exec(`UPDATE deployments SET pinned = ? WHERE id = ?`, pinned, id)
+	return err
+}
+
+func scanDeployments(rows *sql.Rows) ([]Deployment, error) {
+	defer rows.Close()
+
+	var deps []Deployment
+	for rows.Next() {
+		var d Deployment
+		if err := rows.Scan(&d.ID, &d.UserID, &d.SiteID, &d.CreatedAt, &d.Status,
+			&d.URL, &d.CommitSha, &d.CommitMessage, &d.CommitAuthor, &d.CommitAvatar, &d.LogsPath, &d.OutputDir, &d.Pinned, &d.PreviewID); err != nil {
+			return nil, err
+		}
+		deps = append(deps, d)
+	}
+	return deps, rows.Err()
+}
+
+func ListExpiredDeployments(db *sql.DB, keep int) ([]Deployment, error) {
+	rows, err := db.Query(`
+		SELECT d.id, d.userId, d.siteId, d.createdAt, d.status, d.url, d.commitSha, d.commitMessage, d.commitAuthor, d.commitAvatar, d.logsPath, d.outputDir, d.pinned, d.previewId
+		FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY siteId ORDER BY createdAt DESC) AS rank
+			FROM deployments
+			WHERE status IN ('running', 'stopped') AND previewId IS NULL
+		) d
+		JOIN sites s ON s.id = d.siteId
+		WHERE d.rank > ? AND d.pinned = 0 AND d.status = 'stopped'
+		AND (s.currentDeploymentId IS NULL OR s.currentDeploymentId != d.id)
+		ORDER BY d.siteId, d.createdAt
+	`, keep)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeployments(rows)
+}
+
+func ListAbandonedDeployments(db *sql.DB) ([]Deployment, error) {
+	rows, err := db.Query(`
+		SELECT d.id, d.userId, d.siteId, d.createdAt, d.status, d.url, d.commitSha, d.commitMessage, d.commitAuthor, d.commitAvatar, d.logsPath, d.outputDir, d.pinned, d.previewId
+		FROM deployments d
+		WHERE (d.status IN ('failed', 'canceled', 'superseded')
+			OR (d.previewId IS NOT NULL AND d.status = 'stopped'
+				AND NOT EXISTS (SELECT 1 FROM sitePreviews p WHERE p.deploymentId = d.id)))
+		AND EXISTS (SELECT 1 FROM deploymentFiles f WHERE f.deploymentId = d.id)
+		ORDER BY d.siteId, d.createdAt
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeployments(rows)
+}
+
+func ExpireDeployment(db *sql.DB, id string, markExpired bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM deploymentFiles WHERE deploymentId = ?`, id); err != nil {
+		return err
+	}
+	if markExpired {
+		if _, err := tx.Exec(`UPDATE deployments SET status = 'expired' WHERE id = ?`, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
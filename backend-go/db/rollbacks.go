@@ -0,0 +1,105 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+type DeploymentRollback struct {
+	ID               string  `json:"id"`
+	SiteID           string  `json:"siteId"`
+	FromDeploymentID *string `json:"fromDeploymentId"`
+	ToDeploymentID   string  `json:"toDeploymentId"`
+	ActorID          *string `json:"actorId"`
+	Via              string  `json:"via"`
+	CreatedAt        string  `json:"createdAt"`
+}
+
+func GetPreviousDeployment(db *sql.DB, siteID, currentDeployID string) (*Deployment, error) {
+	var d Deployment
+	err := db.QueryRow(`
+		SELECT d.id, d.userId, d.siteId, d.createdAt, d.status, d.url, d.commitSha, d.commitMessage, d.commitAuthor, d.commitAvatar, d.logsPath, d.outputDir, d.pinned, d.previewId
+		FROM deployments d
+		WHERE d.siteId = ? AND d.id != ? AND d.status = 'stopped' AND d.previewId IS NULL
+		AND (? = '' OR d.createdAt < (SELECT createdAt FROM deployments WHERE id = ?))
+		ORDER BY d.createdAt DESC
+		LIMIT 1
+	`, siteID, currentDeployID, currentDeployID, currentDeployID).Scan(&d.ID, &d.UserID, &d.SiteID, &d.CreatedAt, &d.Status,
+		&d.URL, &d.CommitSha, &d.CommitMessage, &d.CommitAuthor, &d.CommitAvatar, &d.LogsPath, &d.OutputDir, &d.Pinned, &d.PreviewID)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func PromoteDeployment(db *sql.DB, rollbackID, siteID, deployID, actorID, via string) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var current sql.NullString
+	if err := tx.QueryRow(`SELECT currentDeploymentId FROM sites WHERE id = ?`, siteID).Scan(&current); err != nil {
+		return "", err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE deployments SET status = 'stopped'
+		WHERE siteId = ? AND id != ? AND status = 'running' AND previewId IS NULL
+	`, siteID, deployID); err != nil {
+		return "", err
+	}
+
+	if _, err := tx.Exec(`UPDATE deployments SET status = 'running' WHERE id = ? AND siteId = ?`, deployID, siteID); err != nil {
+		return "", err
+	}
+
+	if _, err := tx.Exec(`UPDATE sites SET currentDeploymentId = ? WHERE id = ?`, deployID, siteID); err != nil {
+		return "", err
+	}
+
+	var actor sql.NullString
+	if actorID != "" {
+		actor = sql.NullString{String: actorID, Valid: true}
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO deploymentRollbacks (id, siteId, fromDeploymentId, toDeploymentId, actorId, via, createdAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, rollbackID, siteID, current, deployID, actor, via, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return "", err
+	}
+
+	return current.String, tx.Commit()
+}
+
+func ListDeploymentRollbacks(db *sql.DB, siteID string) ([]DeploymentRollback, error) {
+	rows, err := db.Query(`
+		SELECT id, siteId, fromDeploymentId, toDeploymentId, actorId, via, createdAt
+		FROM deploymentRollbacks WHERE siteId = ?
+		ORDER BY createdAt DESC
+	`, siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rollbacks []DeploymentRollback
+	for rows.Next() {
+		var r DeploymentRollback
+		var from, actor, via, createdAt sql.NullString
+		if err := rows.Scan(&r.ID, &r.SiteID, &from, &r.ToDeploymentID, &actor, &via, &createdAt); err != nil {
+			return nil, err
+		}
+		r.FromDeploymentID = nullStringToPtr(from)
+		r.ActorID = nullStringToPtr(actor)
+		r.Via = via.String
+		r.CreatedAt = createdAt.String
+		rollbacks = append(rollbacks, r)
+	}
+	return rollbacks, rows.Err()
+}
@@ -0,0 +1,99 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+type RouteHost struct {
+	Host   string
+	SiteID string
+}
+
+func UpsertRouteHost(db *sql.DB, host, siteID string) error {
+	_, err := db.Exec(`
+		INSERT INTO routeHosts (host, siteId, updatedAt) VALUES (?, ?, ?)
+		ON CONFLICT(host) DO UPDATE SET siteId = excluded.siteId, updatedAt = excluded.updatedAt
+	`, host, siteID, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func DeleteRouteHost(db *sql.DB, host string) error {
+	_, err := db.Exec(`DELETE FROM routeHosts WHERE host = ?`, host)
+	return err
+}
+
+func GetRouteHost(db *sql.DB, host string) (string, error) {
+	var siteID string
+	err := db.QueryRow(`SELECT siteId FROM routeHosts WHERE host = ?`, host).Scan(&siteID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return siteID, err
+}
+
+func ListRouteHosts(db *sql.DB) ([]RouteHost, error) {
+	rows, err := db.Query(`SELECT host, siteId FROM routeHosts ORDER BY host`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hosts []RouteHost
+	for rows.Next() {
+		var h RouteHost
+		if err := rows.Scan(&h.Host, &h.SiteID); err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, rows.Err()
+}
+
+func UpsertRouteDeployment(db *sql.DB, siteID, deployID string) error {
+	_, err := db.Exec(`
+		INSERT INTO routeDeployments (siteId, deploymentId, updatedAt) VALUES (?, ?, ?)
+		ON CONFLICT(siteId) DO UPDATE SET deploymentId = excluded.deploymentId, updatedAt = excluded.updatedAt
+	`, siteID, deployID, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func DeleteRouteDeployment(db *sql.DB, siteID string) error {
+	_, err := db.Exec(`DELETE FROM routeDeployments WHERE siteId = ?`, siteID)
+	return err
+}
+
+func GetRouteDeployment(db *sql.DB, siteID string) (string, error) {
+	var deployID string
+	err := db.QueryRow(`SELECT deploymentId FROM routeDeployments WHERE siteId = ?`, siteID).Scan(&deployID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return deployID, err
+}
+
+func UpsertRoutePreview(db *sql.DB, host, siteID, deployID string) error {
+	_, err := db.Exec(`
+		INSERT INTO routePreviews (host, siteId, deploymentId, updatedAt) VALUES (?, ?, ?, ?)
+		ON CONFLICT(host) DO UPDATE SET siteId = excluded.siteId, deploymentId = excluded.deploymentId, updatedAt = excluded.updatedAt
+	`, host, siteID, deployID, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func DeleteRoutePreview(db *sql.DB, host string) error {
+	_, err := db.Exec(`DELETE FROM routePreviews WHERE host = ?`, host)
+	return err
+}
+
+func GetRoutePreview(db *sql.DB, host string) (string, string, error) {
+	var siteID, deployID string
+	err := db.QueryRow(`SELECT siteId, deploymentId FROM routePreviews WHERE host = ?`, host).Scan(&siteID, &deployID)
+	if err == sql.ErrNoRows {
+		return "", "", nil
+	}
+	return siteID, deployID, err
+}
@@ -224,3 +224,28 @@ func UpdateSiteEnv(db *sql.DB, id, envText string) error {
 	_, err := db.Exec(`UPDATE sites SET envText = ? WHERE id = ?`, envText, id)
 	return err
 }
+
+func GetSiteSecretEnvKeys(db *sql.DB, siteID string) ([]string, error) {
+	var raw sql.NullString
+	if err := db.QueryRow(`SELECT secretEnvKeys FROM sites WHERE id = ?`, siteID).Scan(&raw); err != nil {
+		return nil, err
+	}
+	if !raw.Valid {
+		return nil, nil
+	}
+	keys := []string{}
+	if err := json.Unmarshal([]byte(raw.String), &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func SetSiteSecretEnvKeys(db *sql.DB, siteID string, keys []string) error {
+	var raw sql.NullString
+	if keys != nil {
+		b, _ := json.Marshal(keys)
+		raw = sql.NullString{String: string(b), Valid: true}
+	}
+	_, err := db.Exec(`UPDATE sites SET secretEnvKeys = ? WHERE id = ?`, raw, siteID)
+	return err
+}
@@ -0,0 +1,287 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+type WebhookEndpoint struct {
+	ID        string   `json:"id"`
+	UserID    string   `json:"-"`
+	SiteID    *string  `json:"siteId"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"-"`
+	Events    []string `json:"events"`
+	Enabled   bool     `json:"enabled"`
+	CreatedAt string   `json:"createdAt"`
+}
+
+func (w *WebhookEndpoint) Subscribed(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDelivery struct {
+	ID             string  `json:"id"`
+	EndpointID     string  `json:"endpointId"`
+	Event          string  `json:"event"`
+	Payload        string  `json:"payload"`
+	Status         string  `json:"status"`
+	Attempts       int     `json:"attempts"`
+	NextAttemptAt  *string `json:"nextAttemptAt"`
+	LastAttemptAt  *string `json:"lastAttemptAt"`
+	ResponseStatus *int    `json:"responseStatus"`
+	Error          *string `json:"error"`
+	ReplayOf       *string `json:"replayOf,omitempty"`
+	CreatedAt      string  `json:"createdAt"`
+}
+
+func joinEvents(events []string) string {
+	return strings.Join(events, ",")
+}
+
+func splitEvents(events string) []string {
+	if events == "" {
+		return []string{}
+	}
+	return strings.Split(events, ",")
+}
+
+const webhookEndpointColumns = `id, userId, siteId, url, secret, events, enabled, createdAt`
+
+func scanWebhookEndpoint(row interface{ Scan(...interface{}) error }) (*WebhookEndpoint, error) {
+	var w WebhookEndpoint
+	var siteID sql.NullString
+	var events string
+	var enabled int
+	if err := row.Scan(&w.ID, &w.UserID, &siteID, &w.URL, &w.Secret, &events, &enabled, &w.CreatedAt); err != nil {
+		return nil, err
+	}
+	w.SiteID = nullStringToPtr(siteID)
+	w.Events = splitEvents(events)
+	w.Enabled = enabled == 1
+	return &w, nil
+}
+
+func queryWebhookEndpoints(db *sql.DB, query string, args ...interface{}) ([]WebhookEndpoint, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := []WebhookEndpoint{}
+	for rows.Next() {
+		w, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, *w)
+	}
+	return endpoints, rows.Err()
+}
+
+func CreateWebhookEndpoint(db *sql.DB, id, userID, siteID, url, secret string, events []string) error {
+	_, err := db.Exec(`
+		INSERT INTO webhookEndpoints (id, userId, siteId, url, secret, events, enabled, createdAt)
+		VALUES (?, ?, ?, ?, ?, ?, 1, ?)
+	`, id, userID, toNull(siteID), url, secret, joinEvents(events), time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func GetWebhookEndpoint(db *sql.DB, userID, id string) (*WebhookEndpoint, error) {
+	return scanWebhookEndpoint(db.QueryRow(`
+		SELECT `+webhookEndpointColumns+` FROM webhookEndpoints WHERE id = ? AND userId = ?
+	`, id, userID))
+}
+
+func GetWebhookEndpointByID(db *sql.DB, id string) (*WebhookEndpoint, error) {
+	return scanWebhookEndpoint(db.QueryRow(`
+		SELECT `+webhookEndpointColumns+` FROM webhookEndpoints WHERE id = ?
+	`, id))
+}
+
+func ListWebhookEndpoints(db *sql.DB, userID string) ([]WebhookEndpoint, error) {
+	return queryWebhookEndpoints(db, `
+		SELECT `+webhookEndpointColumns+` FROM webhookEndpoints WHERE userId = ? ORDER BY createdAt
+	`, userID)
+}
+
+func ListWebhookEndpointsForSite(db *sql.DB, userID, siteID string) ([]WebhookEndpoint, error) {
+	return queryWebhookEndpoints(db, `
+		SELECT `+webhookEndpointColumns+` FROM webhookEndpoints
+		WHERE userId = ? AND enabled = 1 AND (siteId IS NULL OR siteId = ?)
+	`, userID, siteID)
+}
+
+func UpdateWebhookEndpoint(db *sql.DB, userID, id, url string, events []string, enabled bool) error {
+	result, err := db.Exec(`
+		UPDATE webhookEndpoints SET url = ?, events = ?, enabled = ? WHERE id = ? AND userId = ?
+	`, url, joinEvents(events), enabled, id, userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func SetWebhookEndpointSecret(db *sql.DB, userID, id, secret string) error {
+	result, err := db.Exec(`UPDATE webhookEndpoints SET secret = ? WHERE id = ? AND userId = ?`, secret, id, userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func DeleteWebhookEndpoint(db *sql.DB, userID, id string) error {
+	result, err := db.Exec(`DELETE FROM webhookEndpoints WHERE id = ? AND userId = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func CountWebhookEndpoints(db *sql.DB, userID string) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM webhookEndpoints WHERE userId = ?`, userID).Scan(&count)
+	return count, err
+}
+
+const webhookDeliveryColumns = `id, endpointId, event, payload, status, attempts, nextAttemptAt, lastAttemptAt, responseStatus, error, replayOf, createdAt`
+
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	var next, last, errMsg, replayOf sql.NullString
+	var status sql.NullInt64
+	if err := row.Scan(&d.ID, &d.EndpointID, &d.Event, &d.Payload, &d.Status, &d.Attempts,
+		&next, &last, &status, &errMsg, &replayOf, &d.CreatedAt); err != nil {
+		return nil, err
+	}
+	d.NextAttemptAt = nullStringToPtr(next)
+	d.LastAttemptAt = nullStringToPtr(last)
+	d.Error = nullStringToPtr(errMsg)
+	d.ReplayOf = nullStringToPtr(replayOf)
+	if status.Valid {
+		code := int(status.Int64)
+		d.ResponseStatus = &code
+	}
+	return &d, nil
+}
+
+func CreateWebhookDelivery(db *sql.DB, id, endpointID, event, payload, replayOf string) error {
+	now := time.Now().UTC().Format(jobTimeFormat)
+	_, err := db.Exec(`
+		INSERT INTO webhookDeliveries (id, endpointId, event, payload, status, attempts, nextAttemptAt, replayOf, createdAt)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?)
+	`, id, endpointID, event, payload, DeliveryPending, now, toNull(replayOf), now)
+	return err
+}
+
+func GetWebhookDelivery(db *sql.DB, endpointID, id string) (*WebhookDelivery, error) {
+	return scanWebhookDelivery(db.QueryRow(`
+		SELECT `+webhookDeliveryColumns+` FROM webhookDeliveries WHERE id = ? AND endpointId = ?
+	`, id, endpointID))
+}
+
+func ListWebhookDeliveries(db *sql.DB, endpointID string, limit int) ([]WebhookDelivery, error) {
+	rows, err := db.Query(`
+		SELECT `+webhookDeliveryColumns+` FROM webhookDeliveries
+		WHERE endpointId = ?
+		ORDER BY createdAt DESC
+		LIMIT ?
+	`, endpointID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+func ClaimDueWebhookDeliveries(db *sql.DB, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	now := time.Now().UTC()
+	rows, err := db.Query(`
+		UPDATE webhookDeliveries SET nextAttemptAt = ?
+		WHERE id IN (
+			SELECT id FROM webhookDeliveries
+			WHERE status = ? AND nextAttemptAt <= ?
+			ORDER BY nextAttemptAt
+			LIMIT ?
+		)
+		RETURNING `+webhookDeliveryColumns+`
+	`, now.Add(lease).Format(jobTimeFormat), DeliveryPending, now.Format(jobTimeFormat), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+func FinishWebhookDeliveryAttempt(db *sql.DB, id, status string, responseStatus int, errMsg string, nextAttempt *time.Time) error {
+	var next sql.NullString
+	if nextAttempt != nil {
+		next = sql.NullString{String: nextAttempt.UTC().Format(jobTimeFormat), Valid: true}
+	}
+	var code sql.NullInt64
+	if responseStatus > 0 {
+		code = sql.NullInt64{Int64: int64(responseStatus), Valid: true}
+	}
+	_, err := db.Exec(`
+		UPDATE webhookDeliveries
+		SET status = ?, attempts = attempts + 1, nextAttemptAt = ?, lastAttemptAt = ?, responseStatus = ?, error = ?
+		WHERE id = ?
+	`, status, next, time.Now().UTC().Format(jobTimeFormat), code, toNull(errMsg), id)
+	return err
+}
+
+func PruneWebhookDeliveries(db *sql.DB, olderThan time.Duration) (int64, error) {
+	cutoff := time.Now().UTC().Add(-olderThan).Format(jobTimeFormat)
+	result, err := db.Exec(`DELETE FROM webhookDeliveries WHERE status != ? AND createdAt < ?`, DeliveryPending, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -6,14 +6,11 @@ package deploy
 
 import (
 	"bytes"
-	"crypto/sha1"
 	"encoding/base64"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"sync"
 	"time"
 )
@@ -22,11 +19,19 @@ type B2Client struct {
 	KeyID       string
 	AppKey      string
 	BucketID    string
+	BucketName  string
 	AuthToken   string
 	APIURL      string
 	DownloadURL string
 	Client      *http.Client
-	mu          sync.Mutex
+
+	UploadClient       *http.Client
+	LargeFileThreshold int64
+	PartSize           int64
+	minPartSize        int64
+	uploadURLs         chan *b2UploadTarget
+
+	mu sync.Mutex
 }
 
 func NewB2Client(keyID, appKey, bucketID string) *B2Client {
@@ -35,6 +40,10 @@ func NewB2Client(keyID, appKey, bucketID string) *B2Client {
 		AppKey:   appKey,
 		BucketID: bucketID,
 		Client:   &http.Client{Timeout: 60 * time.Second},
+
+		UploadClient:       &http.Client{Timeout: 30 * time.Minute},
+		LargeFileThreshold: defaultB2LargeFileThreshold,
+		uploadURLs:         make(chan *b2UploadTarget, b2UploadURLPoolSize),
 	}
 }
 
@@ -60,7 +69,8 @@ func (c *B2Client) Authorize() error {
 		AuthorizationToken      string `json:"authorizationToken"`
 		APIURL                  string `json:"apiUrl"`
 		DownloadURL             string `json:"downloadUrl"`
-		AbsoluteMinimumPartSize int    `json:"absoluteMinimumPartSize"`
+		AbsoluteMinimumPartSize int64  `json:"absoluteMinimumPartSize"`
+		RecommendedPartSize     int64  `json:"recommendedPartSize"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
 		return err
@@ -70,6 +80,10 @@ func (c *B2Client) Authorize() error {
 	c.AuthToken = res.AuthorizationToken
 	c.APIURL = res.APIURL
 	c.DownloadURL = res.DownloadURL
+	c.minPartSize = res.AbsoluteMinimumPartSize
+	if c.PartSize == 0 {
+		c.PartSize = res.RecommendedPartSize
+	}
 	c.mu.Unlock()
 
 	return nil
@@ -100,7 +114,7 @@ func (c *B2Client) GetUploadURL() (string, string, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return "", "", fmt.Errorf("get_upload_url failed: %d", resp.StatusCode)
+		return "", "", &b2Error{Op: "get_upload_url", Status: resp.StatusCode, RetryAfter: retryAfter(resp)}
 	}
 
 	var res struct {
@@ -114,56 +128,133 @@ func (c *B2Client) GetUploadURL() (string, string, error) {
 	return res.UploadURL, res.AuthorizationToken, nil
 }
 
-func (c *B2Client) UploadFile(fileName string, content []byte, contentType string) error {
+func (c *B2Client) List(prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	start := ""
+	for {
+		files, next, err := c.listFiles(prefix, start, 1000)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, files...)
+		if next == "" {
+			break
+		}
+		start = next
+	}
+	return objects, nil
+}
 
-	c.mu.Lock()
-	apiURL := c.APIURL
-	c.mu.Unlock()
+func (c *B2Client) DeletePrefix(prefix string) error {
+	return c.DeleteFilesWithPrefix(prefix)
+}
 
-	if apiURL == "" {
-		if err := c.Authorize(); err != nil {
+func (c *B2Client) Delete(keys []string) error {
+	for _, key := range keys {
+		var res struct {
+			Files []struct {
+				FileName string `json:"fileName"`
+				FileID   string `json:"fileId"`
+			} `json:"files"`
+		}
+		err := c.call("b2_list_file_versions", map[string]interface{}{
+			"bucketId":      c.BucketID,
+			"startFileName": key,
+			"prefix":        key,
+			"maxFileCount":  100,
+		}, &res)
+		if err != nil {
 			return err
 		}
+
+		for _, f := range res.Files {
+			if f.FileName != key {
+				continue
+			}
+			if err := c.DeleteFileVersion(f.FileName, f.FileID); err != nil {
+				return err
+			}
+		}
 	}
+	return nil
+}
 
-	uploadURL, uploadToken, err := c.GetUploadURL()
+func (c *B2Client) Stat(key string) (*ObjectInfo, error) {
+	files, _, err := c.listFiles(key, key, 1)
 	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 || files[0].Key != key {
+		return nil, ErrObjectNotFound
+	}
+	return &files[0], nil
+}
 
-		if err := c.Authorize(); err != nil {
-			return err
+func (c *B2Client) Open(key string) (io.ReadCloser, *ObjectInfo, error) {
+	if c.BucketName == "" {
+		return nil, nil, fmt.Errorf("B2 bucket name is not configured")
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		c.mu.Lock()
+		downloadURL := c.DownloadURL
+		authToken := c.AuthToken
+		c.mu.Unlock()
+
+		if downloadURL == "" || attempt > 0 {
+			if err := c.Authorize(); err != nil {
+				return nil, nil, err
+			}
+			c.mu.Lock()
+			downloadURL = c.DownloadURL
+			authToken = c.AuthToken
+			c.mu.Unlock()
 		}
-		uploadURL, uploadToken, err = c.GetUploadURL()
+
+		req, _ := http.NewRequest("GET", downloadURL+"/file/"+c.BucketName+"/"+uriEscape(key, true), nil)
+		req.Header.Set("Authorization", authToken)
+
+		resp, err := c.Client.Do(req)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
-	}
-
-	hash := sha1.Sum(content)
-	sha1Str := hex.EncodeToString(hash[:])
 
-	encodedName := url.PathEscape(fileName)
+		switch resp.StatusCode {
+		case 200:
+			return resp.Body, &ObjectInfo{
+				Key:         key,
+				Size:        resp.ContentLength,
+				ContentType: resp.Header.Get("Content-Type"),
+			}, nil
+		case 404:
+			resp.Body.Close()
+			return nil, nil, ErrObjectNotFound
+		case 401:
+			resp.Body.Close()
+			continue
+		default:
+			resp.Body.Close()
+			return nil, nil, fmt.Errorf("download_file_by_name failed: %d", resp.StatusCode)
+		}
+	}
 
-	req, _ := http.NewRequest("POST", uploadURL, bytes.NewBuffer(content))
-	req.Header.Set("Authorization", uploadToken)
-	req.Header.Set("X-Bz-File-Name", encodedName)
-	req.Header.Set("Content-Type", contentType)
-	req.Header.Set("X-Bz-Content-Sha1", sha1Str)
+	return nil, nil, fmt.Errorf("download_file_by_name failed: unauthorized")
+}
 
-	resp, err := c.Client.Do(req)
+func (c *B2Client) ListFileNames(prefix string, startFileName string, maxFileCount int) ([]string, string, error) {
+	files, next, err := c.listFiles(prefix, startFileName, maxFileCount)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("upload_file failed: %d %s", resp.StatusCode, string(body))
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Key)
 	}
-
-	return nil
+	return names, next, nil
 }
 
-func (c *B2Client) ListFileNames(prefix string, startFileName string, maxFileCount int) ([]string, string, error) {
+func (c *B2Client) listFiles(prefix string, startFileName string, maxFileCount int) ([]ObjectInfo, string, error) {
 	c.mu.Lock()
 	apiURL := c.APIURL
 	authToken := c.AuthToken
@@ -208,8 +299,10 @@ func (c *B2Client) ListFileNames(prefix string, startFileName string, maxFileCou
 
 	var res struct {
 		Files []struct {
-			FileName string `json:"fileName"`
-			FileID   string `json:"fileId"`
+			FileName      string `json:"fileName"`
+			FileID        string `json:"fileId"`
+			ContentLength int64  `json:"contentLength"`
+			ContentType   string `json:"contentType"`
 		} `json:"files"`
 		NextFileName *string `json:"nextFileName"`
 	}
@@ -217,9 +310,9 @@ func (c *B2Client) ListFileNames(prefix string, startFileName string, maxFileCou
 		return nil, "", err
 	}
 
-	var names []string
+	var files []ObjectInfo
 	for _, f := range res.Files {
-		names = append(names, f.FileName)
+		files = append(files, ObjectInfo{Key: f.FileName, Size: f.ContentLength, ContentType: f.ContentType})
 	}
 
 	next := ""
@@ -227,7 +320,7 @@ func (c *B2Client) ListFileNames(prefix string, startFileName string, maxFileCou
 		next = *res.NextFileName
 	}
 
-	return names, next, nil
+	return files, next, nil
 }
 
 func (c *B2Client) DeleteFileVersion(fileName, fileID string) error {
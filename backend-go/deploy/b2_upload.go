@@ -0,0 +1,438 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultB2LargeFileThreshold = 200 << 20
+	defaultB2PartSize           = 100 << 20
+	b2UploadURLPoolSize         = 32
+	b2MaxAttempts               = 5
+	b2MaxParts                  = 10000
+)
+
+type b2UploadTarget struct {
+	URL   string
+	Token string
+}
+
+type b2Error struct {
+	Op         string
+	Status     int
+	Code       string
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *b2Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s failed: %d %s: %s", e.Op, e.Status, e.Code, e.Message)
+	}
+	return fmt.Sprintf("%s failed: %d", e.Op, e.Status)
+}
+
+func (e *b2Error) retryable() bool {
+	switch e.Status {
+	case 401, 408, 429, 500, 503:
+		return true
+	}
+	return false
+}
+
+func newB2Error(op string, resp *http.Response) *b2Error {
+	e := &b2Error{Op: op, Status: resp.StatusCode, RetryAfter: retryAfter(resp)}
+	var res struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&res) == nil {
+		e.Code = res.Code
+		e.Message = res.Message
+	}
+	return e
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs <= 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+func b2Backoff(attempt int, err error) {
+	d := 500 * time.Millisecond << attempt
+	if d > 30*time.Second {
+		d = 30 * time.Second
+	}
+	d += time.Duration(rand.Int63n(int64(d)/2 + 1))
+
+	var be *b2Error
+	if errors.As(err, &be) && be.RetryAfter > d {
+		d = be.RetryAfter
+	}
+	time.Sleep(d)
+}
+
+func isRetryable(err error) bool {
+	var be *b2Error
+	if errors.As(err, &be) {
+		return be.retryable()
+	}
+	return true
+}
+
+func (c *B2Client) ensureAuthorized() (string, string, error) {
+	c.mu.Lock()
+	apiURL := c.APIURL
+	authToken := c.AuthToken
+	c.mu.Unlock()
+
+	if apiURL == "" {
+		if err := c.Authorize(); err != nil {
+			return "", "", err
+		}
+		c.mu.Lock()
+		apiURL = c.APIURL
+		authToken = c.AuthToken
+		c.mu.Unlock()
+	}
+	return apiURL, authToken, nil
+}
+
+func (c *B2Client) call(op string, payload interface{}, out interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < b2MaxAttempts; attempt++ {
+		if attempt > 0 {
+			b2Backoff(attempt-1, lastErr)
+		}
+
+		apiURL, authToken, err := c.ensureAuthorized()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		req, _ := http.NewRequest("POST", apiURL+"/b2api/v2/"+op, bytes.NewReader(body))
+		req.Header.Set("Authorization", authToken)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := c.Client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode == 200 {
+			if out != nil {
+				err = json.NewDecoder(resp.Body).Decode(out)
+			}
+			resp.Body.Close()
+			return err
+		}
+
+		be := newB2Error(op, resp)
+		resp.Body.Close()
+		lastErr = be
+		if be.Status == 401 {
+			c.mu.Lock()
+			c.APIURL = ""
+			c.mu.Unlock()
+		}
+		if !be.retryable() {
+			return be
+		}
+	}
+	return lastErr
+}
+
+func (c *B2Client) takeUploadURL() (*b2UploadTarget, error) {
+	select {
+	case target := <-c.uploadURLs:
+		return target, nil
+	default:
+	}
+
+	if _, _, err := c.ensureAuthorized(); err != nil {
+		return nil, err
+	}
+	uploadURL, uploadToken, err := c.GetUploadURL()
+	var be *b2Error
+	if errors.As(err, &be) && be.Status == 401 {
+		if err := c.Authorize(); err != nil {
+			return nil, err
+		}
+		uploadURL, uploadToken, err = c.GetUploadURL()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b2UploadTarget{URL: uploadURL, Token: uploadToken}, nil
+}
+
+func (c *B2Client) releaseUploadURL(target *b2UploadTarget) {
+	select {
+	case c.uploadURLs <- target:
+	default:
+	}
+}
+
+type readerAtSeeker interface {
+	io.ReaderAt
+	io.Seeker
+}
+
+func spoolUpload(body io.Reader) (*os.File, int64, error) {
+	f, err := os.CreateTemp("", "b2-upload-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	os.Remove(f.Name())
+
+	n, err := io.Copy(f, body)
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, n, nil
+}
+
+func sha1Section(r io.ReaderAt, offset, size int64) (string, error) {
+	h := sha1.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, offset, size)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func sectionBody(r io.ReaderAt, offset, size int64) io.Reader {
+	if size == 0 {
+		return http.NoBody
+	}
+	return io.NewSectionReader(r, offset, size)
+}
+
+func (c *B2Client) UploadFile(fileName string, content []byte, contentType string) error {
+	return c.Upload(fileName, bytes.NewReader(content), int64(len(content)), contentType)
+}
+
+func (c *B2Client) Upload(key string, body io.Reader, size int64, contentType string) error {
+	src, ok := body.(readerAtSeeker)
+	if ok && size < 0 {
+		end, err := src.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		size = end
+	}
+	if !ok {
+		f, n, err := spoolUpload(body)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if size >= 0 && n != size {
+			return fmt.Errorf("short read for %s: got %d of %d bytes", key, n, size)
+		}
+		src, size = f, n
+	}
+
+	if contentType == "" {
+		contentType = "b2/x-auto"
+	}
+
+	threshold := c.LargeFileThreshold
+	if threshold <= 0 {
+		threshold = defaultB2LargeFileThreshold
+	}
+	if size > threshold {
+		return c.uploadLarge(key, src, size, contentType)
+	}
+	return c.uploadSmall(key, src, size, contentType)
+}
+
+func (c *B2Client) uploadSmall(key string, src io.ReaderAt, size int64, contentType string) error {
+	sum, err := sha1Section(src, 0, size)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < b2MaxAttempts; attempt++ {
+		if attempt > 0 {
+			b2Backoff(attempt-1, lastErr)
+		}
+
+		target, err := c.takeUploadURL()
+		if err != nil {
+			if !isRetryable(err) {
+				return err
+			}
+			lastErr = err
+			continue
+		}
+
+		req, _ := http.NewRequest("POST", target.URL, sectionBody(src, 0, size))
+		req.ContentLength = size
+		req.Header.Set("Authorization", target.Token)
+		req.Header.Set("X-Bz-File-Name", uriEscape(key, true))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("X-Bz-Content-Sha1", sum)
+
+		resp, err := c.UploadClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode == 200 {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			c.releaseUploadURL(target)
+			return nil
+		}
+
+		be := newB2Error("upload_file", resp)
+		resp.Body.Close()
+		lastErr = be
+		if !be.retryable() {
+			return be
+		}
+	}
+	return lastErr
+}
+
+func (c *B2Client) partSize(size int64) int64 {
+	c.mu.Lock()
+	partSize := c.PartSize
+	minPartSize := c.minPartSize
+	c.mu.Unlock()
+
+	if partSize <= 0 {
+		partSize = defaultB2PartSize
+	}
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+	if size/partSize >= b2MaxParts {
+		partSize = (size + b2MaxParts - 1) / b2MaxParts
+	}
+	return partSize
+}
+
+func (c *B2Client) uploadLarge(key string, src io.ReaderAt, size int64, contentType string) error {
+	var started struct {
+		FileID string `json:"fileId"`
+	}
+	err := c.call("b2_start_large_file", map[string]string{
+		"bucketId":    c.BucketID,
+		"fileName":    key,
+		"contentType": contentType,
+	}, &started)
+	if err != nil {
+		return err
+	}
+
+	if err := c.uploadParts(started.FileID, src, size); err != nil {
+		if cancelErr := c.call("b2_cancel_large_file", map[string]string{"fileId": started.FileID}, nil); cancelErr != nil {
+			fmt.Printf("Warning: failed to cancel large file %s: %v\n", key, cancelErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *B2Client) uploadParts(fileID string, src io.ReaderAt, size int64) error {
+	partSize := c.partSize(size)
+
+	var target *b2UploadTarget
+	var sums []string
+	for offset, part := int64(0), 1; offset < size; offset, part = offset+partSize, part+1 {
+		length := partSize
+		if offset+length > size {
+			length = size - offset
+		}
+
+		sum, err := sha1Section(src, offset, length)
+		if err != nil {
+			return err
+		}
+
+		var lastErr error
+		done := false
+		for attempt := 0; attempt < b2MaxAttempts && !done; attempt++ {
+			if attempt > 0 {
+				b2Backoff(attempt-1, lastErr)
+			}
+
+			if target == nil {
+				var res struct {
+					UploadURL          string `json:"uploadUrl"`
+					AuthorizationToken string `json:"authorizationToken"`
+				}
+				if err := c.call("b2_get_upload_part_url", map[string]string{"fileId": fileID}, &res); err != nil {
+					return err
+				}
+				target = &b2UploadTarget{URL: res.UploadURL, Token: res.AuthorizationToken}
+			}
+
+			req, _ := http.NewRequest("POST", target.URL, sectionBody(src, offset, length))
+			req.ContentLength = length
+			req.Header.Set("Authorization", target.Token)
+			req.Header.Set("X-Bz-Part-Number", strconv.Itoa(part))
+			req.Header.Set("X-Bz-Content-Sha1", sum)
+
+			resp, err := c.UploadClient.Do(req)
+			if err != nil {
+				target = nil
+				lastErr = err
+				continue
+			}
+
+			if resp.StatusCode == 200 {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				done = true
+				continue
+			}
+
+			be := newB2Error("upload_part", resp)
+			resp.Body.Close()
+			target = nil
+			lastErr = be
+			if !be.retryable() {
+				return be
+			}
+		}
+		if !done {
+			return lastErr
+		}
+		sums = append(sums, sum)
+	}
+
+	return c.call("b2_finish_large_file", map[string]interface{}{
+		"fileId":        fileID,
+		"partSha1Array": sums,
+	}, nil)
+}
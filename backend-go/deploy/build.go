@@ -8,10 +8,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 func validateBuildCommand(cmd string) error {
@@ -60,25 +63,93 @@ func fileExists(path string) bool {
 	return err == nil
 }
 
+func resolveWithin(root, rel string) (string, error) {
+	rel = strings.TrimSpace(filepath.ToSlash(rel))
+	rel = strings.Trim(rel, "/")
+	if rel == "" || rel == "." {
+		return root, nil
+	}
+
+	for _, part := range strings.Split(rel, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("path %q must not contain '..'", rel)
+		}
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+
+	target := filepath.Join(root, filepath.FromSlash(rel))
+	realTarget, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("path %q does not exist", rel)
+		}
+		return "", err
+	}
+
+	if realTarget != realRoot && !strings.HasPrefix(realTarget, realRoot+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q escapes the repository", rel)
+	}
+
+	return target, nil
+}
+
 type BuildSystem struct {
-	RootDir string
-	Env     []string
-	Logger  func(string)
-	Cache   *BuildCache
-	SiteID  string
+	RootDir   string
+	RepoDir   string
+	OutputDir string
+	HomeDir   string
+	Vars      BuildVars
+	Env       []string
+	Log       *BuildLog
+	Cache     *BuildCache
+	SiteID    string
+
+	Executor       Executor
+	Timeout        time.Duration
+	MaxOutputBytes int64
+	outputBytes    atomic.Int64
+}
+
+func (b *BuildSystem) InstallDir() string {
+	if b.RepoDir == "" {
+		return b.RootDir
+	}
+
+	dir := b.RootDir
+	for {
+		for _, name := range lockfileNames {
+			if fileExists(filepath.Join(dir, name)) {
+				return dir
+			}
+		}
+		if dir == b.RepoDir {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir || !strings.HasPrefix(parent, b.RepoDir) {
+			break
+		}
+		dir = parent
+	}
+	return b.RootDir
 }
 
 func (b *BuildSystem) DetectPackageManager() string {
-	if fileExists(filepath.Join(b.RootDir, "bun.lockb")) || fileExists(filepath.Join(b.RootDir, "bun.lock")) {
+	dir := b.InstallDir()
+	if fileExists(filepath.Join(dir, "bun.lockb")) || fileExists(filepath.Join(dir, "bun.lock")) {
 		return "bun"
 	}
-	if fileExists(filepath.Join(b.RootDir, "pnpm-lock.yaml")) {
+	if fileExists(filepath.Join(dir, "pnpm-lock.yaml")) {
 		return "pnpm"
 	}
-	if fileExists(filepath.Join(b.RootDir, "yarn.lock")) {
+	if fileExists(filepath.Join(dir, "yarn.lock")) {
 		return "yarn"
 	}
-	if fileExists(filepath.Join(b.RootDir, "package-lock.json")) {
+	if fileExists(filepath.Join(dir, "package-lock.json")) {
 		return "npm"
 	}
 
@@ -86,15 +157,16 @@ func (b *BuildSystem) DetectPackageManager() string {
 }
 
 func (b *BuildSystem) InstallArgs(pm string) []string {
+	dir := b.InstallDir()
 
 	switch pm {
 	case "npm":
-		if fileExists(filepath.Join(b.RootDir, "package-lock.json")) {
+		if fileExists(filepath.Join(dir, "package-lock.json")) {
 			return []string{"ci", "--include=dev"}
 		}
 		return []string{"install", "--include=dev"}
 	case "yarn":
-		if fileExists(filepath.Join(b.RootDir, "yarn.lock")) {
+		if fileExists(filepath.Join(dir, "yarn.lock")) {
 			return []string{"install", "--frozen-lockfile", "--production=false"}
 		}
 		return []string{"install", "--production=false"}
@@ -117,10 +189,47 @@ func (b *BuildSystem) BuildArgs(pm string) []string {
 	}
 }
 
+func (b *BuildSystem) homeDir() string {
+	if b.HomeDir != "" {
+		return b.HomeDir
+	}
+	return b.RootDir
+}
+
+func (b *BuildSystem) commandEnv(nodeEnv string) []string {
+	return buildEnv(b.homeDir(), b.Vars, b.Env, nodeEnv)
+}
+
 func (b *BuildSystem) RunCommand(ctx context.Context, name string, args ...string) error {
-	cmd := exec.CommandContext(ctx, name, args...)
-	cmd.Dir = b.RootDir
-	cmd.Env = append(os.Environ(), b.Env...)
+	return b.runCommandIn(ctx, b.RootDir, b.commandEnv("production"), name, args...)
+}
+
+func (b *BuildSystem) runCommandIn(ctx context.Context, dir string, env []string, name string, args ...string) error {
+	executor := b.Executor
+	if executor == nil {
+		executor = localExecutor{}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	writable := []string{b.homeDir()}
+	if b.RepoDir != "" {
+		writable = append(writable, b.RepoDir)
+	} else {
+		writable = append(writable, b.RootDir)
+	}
+
+	cmd, err := executor.Command(ctx, ExecSpec{
+		Dir:      dir,
+		Env:      env,
+		Writable: writable,
+		Name:     name,
+		Args:     args,
+	})
+	if err != nil {
+		return err
+	}
 
 	stdout, _ := cmd.StdoutPipe()
 	stderr, _ := cmd.StderrPipe()
@@ -129,48 +238,78 @@ func (b *BuildSystem) RunCommand(ctx context.Context, name string, args ...strin
 		return err
 	}
 
-	go func() {
-		buf := make([]byte, 1024)
+	forward := func(r io.Reader, w io.WriteCloser) {
+		defer w.Close()
+		buf := make([]byte, 32*1024)
 		for {
-			n, err := stdout.Read(buf)
-			if n > 0 && b.Logger != nil {
-				b.Logger(string(buf[:n]))
+			n, err := r.Read(buf)
+			if n > 0 {
+				total := b.outputBytes.Add(int64(n))
+				if b.MaxOutputBytes > 0 && total > b.MaxOutputBytes {
+					cancel(errOutputLimit)
+				} else {
+					w.Write(buf[:n])
+				}
 			}
 			if err != nil {
 				break
 			}
 		}
-	}()
+	}
 
+	var wg sync.WaitGroup
+	wg.Add(2)
 	go func() {
-		buf := make([]byte, 1024)
-		for {
-			n, err := stderr.Read(buf)
-			if n > 0 && b.Logger != nil {
-				b.Logger(string(buf[:n]))
-			}
-			if err != nil {
-				break
-			}
-		}
+		defer wg.Done()
+		forward(stdout, b.Log.Stream(StreamStdout))
 	}()
+	go func() {
+		defer wg.Done()
+		forward(stderr, b.Log.Stream(StreamStderr))
+	}()
+	wg.Wait()
 
-	return cmd.Wait()
+	err = cmd.Wait()
+	if cause := context.Cause(ctx); errors.Is(cause, errOutputLimit) {
+		return fmt.Errorf("%w (limit %d bytes)", errOutputLimit, b.MaxOutputBytes)
+	}
+	return err
 }
 
 func (b *BuildSystem) Build(ctx context.Context, customCommand string) (string, error) {
 
+	if b.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, b.Timeout, fmt.Errorf("build timed out after %s", b.Timeout))
+		defer cancel()
+	}
+
+	outputDir, err := b.build(ctx, customCommand)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return "", context.Cause(ctx)
+	}
+	return outputDir, err
+}
+
+func (b *BuildSystem) build(ctx context.Context, customCommand string) (string, error) {
+
+	if err := os.MkdirAll(filepath.Join(b.homeDir(), "tmp"), 0755); err != nil {
+		return "", fmt.Errorf("failed to prepare build home: %w", err)
+	}
+
 	pm := b.DetectPackageManager()
+	installDir := b.InstallDir()
 
 	if fileExists(filepath.Join(b.RootDir, "package.json")) {
+		b.Log.SetStage(StageInstall)
 		cacheHit := false
 		lockHash := ""
 		if b.Cache != nil && b.SiteID != "" {
-			lockHash = b.Cache.LockfileHash(b.RootDir)
+			lockHash = b.Cache.LockfileHash(installDir)
 			if lockHash != "" {
-				cacheHit = b.Cache.RestoreNodeModules(b.SiteID, b.RootDir, lockHash, b.Logger)
-				if cacheHit && b.Logger != nil {
-					b.Logger("Cache hit: restored node_modules from cache\n")
+				cacheHit = b.Cache.RestoreNodeModules(b.SiteID, installDir, lockHash, b.Log.Info)
+				if cacheHit {
+					b.Log.Info("Cache hit: restored node_modules from cache")
 				}
 			}
 		}
@@ -178,68 +317,108 @@ func (b *BuildSystem) Build(ctx context.Context, customCommand string) (string,
 		if !cacheHit {
 			installArgs := b.InstallArgs(pm)
 
-			if b.Logger != nil {
-				if lockHash != "" {
-					b.Logger("Cache miss: installing dependencies fresh\n")
-				}
-				b.Logger(fmt.Sprintf("Installing dependencies with %s %v...\n", pm, installArgs))
+			if lockHash != "" {
+				b.Log.Info("Cache miss: installing dependencies fresh")
+			}
+			if installDir != b.RootDir {
+				b.Log.Info("Lockfile found at workspace root, installing from there")
 			}
+			b.Log.Info(fmt.Sprintf("Installing dependencies with %s %v...", pm, installArgs))
 
-			if err := b.RunCommand(ctx, pm, installArgs...); err != nil {
+			if err := b.runCommandIn(ctx, installDir, b.commandEnv(""), pm, installArgs...); err != nil {
 				return "", fmt.Errorf("install failed: %w", err)
 			}
 
 			if b.Cache != nil && b.SiteID != "" && lockHash != "" {
-				if b.Logger != nil {
-					b.Logger("Saving node_modules to cache...\n")
-				}
-				b.Cache.SaveNodeModules(b.SiteID, b.RootDir, lockHash, b.Logger)
+				b.Log.Info("Saving node_modules to cache...")
+				b.Cache.SaveNodeModules(b.SiteID, installDir, lockHash, b.Log.Info)
 			}
 		}
 	}
 
+	b.Log.SetStage(StageBuild)
 	if customCommand != "" {
 		if err := validateBuildCommand(customCommand); err != nil {
-			if b.Logger != nil {
-				b.Logger(fmt.Sprintf("Invalid build command: %v\n", err))
-			}
+			b.Log.Error(fmt.Sprintf("Invalid build command: %v", err))
 			return "", fmt.Errorf("invalid build command: %w", err)
 		}
-		if b.Logger != nil {
-			b.Logger(fmt.Sprintf("Running custom build command: %s\n", customCommand))
-		}
+		b.Log.Info(fmt.Sprintf("Running custom build command: %s", customCommand))
 		if err := b.RunCommand(ctx, "sh", "-c", customCommand); err != nil {
 			return "", fmt.Errorf("build failed: %w", err)
 		}
 	} else if fileExists(filepath.Join(b.RootDir, "package.json")) {
 
 		buildArgs := b.BuildArgs(pm)
-		if b.Logger != nil {
-			b.Logger(fmt.Sprintf("Building with %s %v...\n", pm, buildArgs))
-		}
+		b.Log.Info(fmt.Sprintf("Building with %s %v...", pm, buildArgs))
 		if err := b.RunCommand(ctx, pm, buildArgs...); err != nil {
 			return "", fmt.Errorf("build failed: %w", err)
 		}
 	}
 
+	if strings.TrimSpace(b.OutputDir) != "" {
+		return b.ConfiguredOutputDirectory()
+	}
 	return b.DetectOutputDirectory()
 }
 
+func (b *BuildSystem) ConfiguredOutputDirectory() (string, error) {
+	name := strings.Trim(strings.TrimSpace(filepath.ToSlash(b.OutputDir)), "/")
+	if name == "" {
+		name = "."
+	}
+
+	path, err := resolveWithin(b.RootDir, name)
+	if err != nil {
+		return "", fmt.Errorf("configured output directory %q not found: %w", name, err)
+	}
+	if isSameDir(path, b.RootDir) && fileExists(filepath.Join(b.RootDir, "package.json")) {
+		return "", fmt.Errorf("configured output directory %q is the repository root; set outputDir to the folder your build writes to", name)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("configured output directory %q is not a directory", name)
+	}
+
+	if !dirHasFiles(path) {
+		return "", fmt.Errorf("configured output directory %q is empty", name)
+	}
+
+	b.Log.Info(fmt.Sprintf("Using configured output directory %s", name))
+	return name, nil
+}
+
+func isSameDir(a, b string) bool {
+	realA, errA := filepath.EvalSymlinks(a)
+	realB, errB := filepath.EvalSymlinks(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return realA == realB
+}
+
+func dirHasFiles(path string) bool {
+	files, err := ListFilesRecursive(path)
+	return err == nil && len(files) > 0
+}
+
 func (b *BuildSystem) DetectOutputDirectory() (string, error) {
 	candidates := []string{"dist", "build", "public", ".svelte-kit/output", "out", "_site"}
 	for _, c := range candidates {
 		path := filepath.Join(b.RootDir, c)
 
-		if fileExists(path) {
+		if fileExists(path) && dirHasFiles(path) {
 
 			return c, nil
 		}
 	}
 
+	if fileExists(filepath.Join(b.RootDir, "package.json")) {
+		return "", fmt.Errorf("build produced no output directory; set outputDir in the site settings")
+	}
+
 	if fileExists(filepath.Join(b.RootDir, "index.html")) {
-		if b.Logger != nil {
-			b.Logger("No build directory detected, but index.html found. Using root directory.")
-		}
+		b.Log.Info("No build directory detected, but index.html found. Using root directory.")
 		return ".", nil
 	}
 
@@ -0,0 +1,246 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StreamSystem = "system"
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+
+	StageClone   = "clone"
+	StageInstall = "install"
+	StageBuild   = "build"
+	StageUpload  = "upload"
+	StageRouting = "routing"
+
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+
+	maxLogLineBytes = 16 * 1024
+)
+
+type LogRecord struct {
+	N      int    `json:"n"`
+	Time   string `json:"ts"`
+	Stream string `json:"stream"`
+	Stage  string `json:"stage,omitempty"`
+	Level  string `json:"level"`
+	Text   string `json:"text"`
+}
+
+func (r LogRecord) String() string {
+	if r.Time == "" {
+		return r.Text
+	}
+	return fmt.Sprintf("[%s] %s", r.Time, r.Text)
+}
+
+func lineLevel(text string) string {
+	s := strings.ToLower(strings.TrimSpace(text))
+	switch {
+	case strings.HasPrefix(s, "error"), strings.HasPrefix(s, "fatal"), strings.HasPrefix(s, "failed"),
+		strings.HasPrefix(s, "npm err"), strings.Contains(s, "error:"), strings.Contains(s, " err!"):
+		return LevelError
+	case strings.HasPrefix(s, "warn"), strings.HasPrefix(s, "npm warn"), strings.Contains(s, "warning:"):
+		return LevelWarn
+	}
+	return LevelInfo
+}
+
+type BuildLog struct {
+	mu       sync.Mutex
+	file     *os.File
+	n        int
+	stage    string
+	redactor Redactor
+	onRecord func(LogRecord)
+}
+
+func OpenBuildLog(path string, onRecord func(LogRecord)) (*BuildLog, error) {
+	l := &BuildLog{onRecord: onRecord}
+	n, err := ReadLogRecords(path, 0, func(LogRecord) error { return nil })
+	if err != nil {
+		return l, err
+	}
+	l.n = n
+	l.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	return l, err
+}
+
+func (l *BuildLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func (l *BuildLog) SetStage(stage string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.stage = stage
+	l.mu.Unlock()
+}
+
+func (l *BuildLog) AddSecrets(values ...string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.redactor.Add(values...)
+	l.mu.Unlock()
+}
+
+func (l *BuildLog) Redact(s string) string {
+	if l == nil {
+		return s
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.redactor.Redact(s)
+}
+
+func (l *BuildLog) maxSecretLen() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.redactor.MaxLen()
+}
+
+func (l *BuildLog) Info(msg string) {
+	l.write(StreamSystem, "", msg)
+}
+
+func (l *BuildLog) Error(msg string) {
+	l.write(StreamSystem, LevelError, msg)
+}
+
+func (l *BuildLog) Write(stream, text string) {
+	l.write(stream, "", text)
+}
+
+func (l *BuildLog) write(stream, level, msg string) {
+	if l == nil {
+		return
+	}
+	ts := time.Now().UTC().Format(time.RFC3339)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	msg = l.redactor.Redact(msg)
+	for _, text := range strings.Split(strings.TrimRight(msg, "\r\n"), "\n") {
+		text = strings.TrimRight(text, "\r")
+		l.n++
+		rec := LogRecord{N: l.n, Time: ts, Stream: stream, Stage: l.stage, Level: level, Text: text}
+		if rec.Level == "" {
+			rec.Level = lineLevel(text)
+		}
+		if l.file != nil {
+			if data, err := json.Marshal(rec); err == nil {
+				l.file.Write(append(data, '\n'))
+			}
+		}
+		if l.onRecord != nil {
+			l.onRecord(rec)
+		}
+	}
+}
+
+func (l *BuildLog) Stream(stream string) io.WriteCloser {
+	w := newLineWriter(func(line string) { l.write(stream, "", line) })
+	w.redact = l.Redact
+	w.holdBack = l.maxSecretLen
+	return w
+}
+
+type lineWriter struct {
+	buf      []byte
+	emit     func(string)
+	redact   func(string) string
+	holdBack func() int
+}
+
+func newLineWriter(emit func(string)) *lineWriter {
+	return &lineWriter{emit: emit}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.flush(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) > maxLogLineBytes {
+		w.flushLong()
+	}
+	return len(p), nil
+}
+
+// flushLong cuts an over-long line. The buffer is redacted before it is cut
+// and the tail that could still hold the start of a secret is carried over,
+// so a secret never ends up split across two records.
+func (w *lineWriter) flushLong() {
+	data := w.buf
+	if w.redact != nil {
+		data = []byte(w.redact(string(w.buf)))
+	}
+	keep := 0
+	if w.holdBack != nil {
+		keep = w.holdBack() - 1
+	}
+	if keep > maxLogLineBytes/2 {
+		keep = maxLogLineBytes / 2
+	}
+	if keep < 0 || keep > len(data) {
+		keep = 0
+	}
+	w.flush(data[:len(data)-keep])
+	w.buf = append([]byte(nil), data[len(data)-keep:]...)
+}
+
+func (w *lineWriter) flush(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if i := bytes.LastIndexByte(line, '\r'); i >= 0 {
+		line = line[i+1:]
+	}
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+	w.emit(string(line))
+}
+
+func (w *lineWriter) Close() error {
+	if len(w.buf) > 0 {
+		w.flush(w.buf)
+		w.buf = nil
+	}
+	return nil
+}
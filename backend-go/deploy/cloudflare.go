@@ -278,37 +278,3 @@ func (c *CloudflareClient) UpdateDNSRecord(zoneID, recordID string, record DNSRe
 	}
 	return nil
 }
-
-func (c *CloudflareClient) EnsureRouting(subdomain, siteID, deployID string) error {
-	if subdomain != "" {
-		if err := c.KVPut("host:"+subdomain, siteID); err != nil {
-			return err
-		}
-	}
-	if deployID != "" {
-		if err := c.KVPut("current:"+siteID, deployID); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func (c *CloudflareClient) RemoveRouting(subdomain, siteID, domain string) error {
-	if domain != "" {
-
-		if err := c.KVDelete("host:" + domain); err != nil {
-			return err
-		}
-	}
-	if subdomain != "" {
-		if err := c.KVDelete("host:" + subdomain); err != nil {
-			return err
-		}
-	}
-	if siteID != "" {
-		if err := c.KVDelete("current:" + siteID); err != nil {
-			return err
-		}
-	}
-	return nil
-}
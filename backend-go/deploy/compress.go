@@ -0,0 +1,249 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	EncodingBrotli = "br"
+	EncodingGzip   = "gzip"
+
+	minCompressSize = 1024
+)
+
+var encodingPreference = []string{EncodingBrotli, EncodingGzip}
+
+func parseAcceptEncoding(header string) map[string]float64 {
+	accepted := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		accepted[name] = q
+	}
+	return accepted
+}
+
+func (e ManifestEntry) Negotiate(acceptEncoding string) (string, ManifestVariant, bool) {
+	if len(e.Encodings) == 0 || acceptEncoding == "" {
+		return "", ManifestVariant{}, false
+	}
+	accepted := parseAcceptEncoding(acceptEncoding)
+
+	best, bestQ := "", 0.0
+	for _, enc := range encodingPreference {
+		if _, ok := e.Encodings[enc]; !ok {
+			continue
+		}
+		q, ok := accepted[enc]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	if best == "" {
+		return "", ManifestVariant{}, false
+	}
+	return best, e.Encodings[best], true
+}
+
+func compressFile(src, dest, encoding string, level int) (string, int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", 0, err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return "", 0, err
+	}
+
+	h := sha256.New()
+	counter := &countingWriter{}
+	sink := io.MultiWriter(out, h, counter)
+
+	var w io.WriteCloser
+	if encoding == EncodingBrotli {
+		w = brotli.NewWriterLevel(sink, level)
+	} else {
+		gw, err := gzip.NewWriterLevel(sink, gzip.BestCompression)
+		if err != nil {
+			out.Close()
+			return "", 0, err
+		}
+		w = gw
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		out.Close()
+		return "", 0, err
+	}
+	if err := w.Close(); err != nil {
+		out.Close()
+		return "", 0, err
+	}
+	if err := out.Close(); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), counter.n, nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+type compressJob struct {
+	Hash   string
+	Source blobSource
+}
+
+func brotliLevel(size int64) int {
+	if size > 1<<20 {
+		return 9
+	}
+	return brotli.BestCompression
+}
+
+func precompress(ctx context.Context, m *Manifest, sources map[string]blobSource, dir string, prev *Manifest) (int, int, error) {
+	known := map[string]map[string]ManifestVariant{}
+	if prev != nil {
+		for _, entry := range prev.Files {
+			if len(entry.Encodings) > 0 {
+				known[entry.Hash] = entry.Encodings
+			}
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, 0, err
+	}
+
+	variants := map[string]map[string]ManifestVariant{}
+	var pending []compressJob
+	for hash, src := range sources {
+		if src.Size < minCompressSize || !isCompressible(src.ContentType) {
+			continue
+		}
+		if enc, ok := known[hash]; ok {
+			variants[hash] = enc
+			continue
+		}
+		pending = append(pending, compressJob{Hash: hash, Source: src})
+	}
+	reused := len(variants)
+
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	work := make(chan compressJob)
+
+	stopped := func() bool {
+		if ctx.Err() != nil {
+			return true
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range work {
+				hash, src := job.Hash, job.Source
+				enc := map[string]ManifestVariant{}
+				for _, encoding := range encodingPreference {
+					if stopped() {
+						break
+					}
+					dest := filepath.Join(dir, hash+"."+encoding)
+					sum, size, err := compressFile(src.Path, dest, encoding, brotliLevel(src.Size))
+					if err != nil {
+						mu.Lock()
+						if firstErr == nil {
+							firstErr = err
+						}
+						mu.Unlock()
+						break
+					}
+					if size >= src.Size*95/100 {
+						os.Remove(dest)
+						continue
+					}
+					enc[encoding] = ManifestVariant{Hash: sum, Size: size}
+
+					mu.Lock()
+					if _, ok := sources[sum]; !ok {
+						sources[sum] = blobSource{Path: dest, Size: size, ContentType: "application/octet-stream"}
+					}
+					mu.Unlock()
+				}
+
+				mu.Lock()
+				if len(enc) > 0 {
+					variants[hash] = enc
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, job := range pending {
+		if stopped() {
+			break
+		}
+		work <- job
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return 0, 0, firstErr
+	}
+	if ctx.Err() != nil {
+		return 0, 0, ctx.Err()
+	}
+
+	for path, entry := range m.Files {
+		if enc, ok := variants[entry.Hash]; ok {
+			entry.Encodings = enc
+			m.Files[path] = entry
+		}
+	}
+	return len(variants) - reused, reused, nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import "testing"
+
+func TestManifestEntryNegotiate(t *testing.T) {
+	both := ManifestEntry{Encodings: map[string]ManifestVariant{
+		EncodingBrotli: {Hash: "br-hash"},
+		EncodingGzip:   {Hash: "gzip-hash"},
+	}}
+	gzipOnly := ManifestEntry{Encodings: map[string]ManifestVariant{
+		EncodingGzip: {Hash: "gzip-hash"},
+	}}
+
+	tests := []struct {
+		name   string
+		entry  ManifestEntry
+		header string
+		want   string
+	}{
+		{"no header", both, "", ""},
+		{"no variants", ManifestEntry{}, "br, gzip", ""},
+		{"prefers brotli", both, "gzip, deflate, br", EncodingBrotli},
+		{"gzip only accepted", both, "gzip, deflate", EncodingGzip},
+		{"brotli missing", gzipOnly, "br, gzip", EncodingGzip},
+		{"higher q wins", both, "br;q=0.5, gzip;q=0.9", EncodingGzip},
+		{"q=0 refuses", both, "br;q=0, gzip", EncodingGzip},
+		{"all refused", both, "br;q=0, gzip;q=0", ""},
+		{"wildcard", both, "*", EncodingBrotli},
+		{"wildcard with explicit refusal", both, "br;q=0, *;q=0.5", EncodingGzip},
+		{"case and spaces", both, " GZIP ; q=1 ", EncodingGzip},
+		{"identity only", both, "identity", ""},
+		{"malformed q keeps default", both, "br;q=abc", EncodingBrotli},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, variant, ok := tt.entry.Negotiate(tt.header)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Fatalf("Negotiate(%q) = %q, %v, want %q", tt.header, got, ok, tt.want)
+			}
+			if ok && variant != tt.entry.Encodings[got] {
+				t.Errorf("Negotiate(%q) variant = %+v, want %+v", tt.header, variant, tt.entry.Encodings[got])
+			}
+		})
+	}
+}
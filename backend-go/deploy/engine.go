@@ -8,9 +8,8 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -34,8 +33,30 @@ type Engine struct {
 	CFAccountID    string
 	CFNamespaceID  string
 	Cache          *BuildCache
+	Storage        Storage
+	Router         Router
+	MaxConcurrent  int
+	MaxPerUser     int
+	Executor       Executor
+	BuildTimeout   time.Duration
+	MaxOutputBytes int64
+
+	RetentionKeep     int
+	RetentionInterval time.Duration
+
+	NotifyThrottle time.Duration
+
 	deploymentsMux sync.Mutex
-	deployments    map[string]context.CancelFunc
+	deployments    map[string]context.CancelCauseFunc
+	logStreams     map[string]chan<- string
+	siteLocks      map[string]*sync.Mutex
+	wake           chan struct{}
+	statuses       chan commitStatus
+	webhookWake    chan struct{}
+	notifyMu       sync.Mutex
+	logFeedsMu     sync.Mutex
+	logFeeds       map[string]map[chan LogRecord]struct{}
+	startOnce      sync.Once
 }
 
 func NewEngine(database *sql.DB, b2KeyID, b2AppKey, b2BucketID, cfToken, cfAccount, cfNamespace string) *Engine {
@@ -56,12 +77,26 @@ func NewEngine(database *sql.DB, b2KeyID, b2AppKey, b2BucketID, cfToken, cfAccou
 		CFAccountID:   cfAccount,
 		CFNamespaceID: cfNamespace,
 		Cache:         &BuildCache{CacheDir: cacheDir},
-		deployments:   make(map[string]context.CancelFunc),
+		Storage:       NewB2Client(b2KeyID, b2AppKey, b2BucketID),
+		Router:        &KVRouter{CF: NewCloudflareClient(cfAccount, cfNamespace, cfToken)},
+		MaxConcurrent: defaultMaxConcurrent,
+		MaxPerUser:    defaultMaxPerUser,
+		Executor:      localExecutor{},
+		deployments:   make(map[string]context.CancelCauseFunc),
+		logStreams:    make(map[string]chan<- string),
+		siteLocks:     make(map[string]*sync.Mutex),
+		wake:          make(chan struct{}, 1),
+		statuses:      make(chan commitStatus, commitStatusQueueSize),
+		webhookWake:   make(chan struct{}, 1),
+		logFeeds:      make(map[string]map[chan LogRecord]struct{}),
 	}
 }
 
-
 func (e *Engine) DeploySite(siteID, userID string, logStream chan<- string) (*db.Deployment, error) {
+	return e.queueDeployment(siteID, userID, nil, logStream)
+}
+
+func (e *Engine) queueDeployment(siteID, userID string, preview *db.SitePreview, logStream chan<- string) (*db.Deployment, error) {
 
 	var commitSha, commitMessage, commitAuthor, commitAvatar *string
 
@@ -78,6 +113,9 @@ func (e *Engine) DeploySite(siteID, userID string, logStream chan<- string) (*db
 			if site.GitBranch.Valid {
 				branch = site.GitBranch.String
 			}
+			if preview != nil {
+				branch = preview.Branch
+			}
 
 			apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/commits/%s", owner, repo, branch)
 			req, _ := http.NewRequest("GET", apiURL, nil)
@@ -131,59 +169,36 @@ func (e *Engine) DeploySite(siteID, userID string, logStream chan<- string) (*db
 	}
 
 	deployID := cuid2.Generate()
-	err = db.CreateDeployment(e.DB, deployID, userID, siteID, "building", commitSha, commitMessage, commitAuthor, commitAvatar)
+	err = db.CreateDeployment(e.DB, deployID, userID, siteID, "queued", commitSha, commitMessage, commitAuthor, commitAvatar)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create deployment record: %w", err)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	e.deploymentsMux.Lock()
-	e.deployments[deployID] = cancel
-	e.deploymentsMux.Unlock()
-
-	go func() {
-		defer func() {
-			e.deploymentsMux.Lock()
-			delete(e.deployments, deployID)
-			e.deploymentsMux.Unlock()
-			cancel()
-			if logStream != nil {
-				close(logStream)
-			}
-		}()
-
-		logsDir := filepath.Join(e.WorkDir, "logs")
-		os.MkdirAll(logsDir, 0755)
-		logsPath := filepath.Join(logsDir, deployID+".log")
-		logFile, _ := os.Create(logsPath)
+	previewID := ""
+	if preview != nil {
+		previewID = preview.ID
+		if err := db.SetDeploymentPreview(e.DB, deployID, previewID); err != nil {
+			db.UpdateDeploymentStatus(e.DB, deployID, "failed", "")
+			return nil, fmt.Errorf("failed to create deployment record: %w", err)
+		}
+	}
 
-		db.UpdateDeploymentLogs(e.DB, deployID, logsPath)
+	if logStream != nil {
+		e.deploymentsMux.Lock()
+		e.logStreams[deployID] = logStream
+		e.deploymentsMux.Unlock()
+	}
 
-		logger := func(msg string) {
-			log.Printf("[Deploy %s] %s", deployID, msg)
-			if logFile != nil {
-				logFile.WriteString(fmt.Sprintf("[%s] %s\n", time.Now().Format(time.RFC3339), msg))
-			}
-			if logStream != nil {
-				logStream <- msg
-			}
-		}
+	if err := db.CreateDeploymentJob(e.DB, deployID, siteID, userID); err != nil {
+		e.detachLogStream(deployID)
+		db.UpdateDeploymentStatus(e.DB, deployID, "failed", "")
+		return nil, fmt.Errorf("failed to queue deployment: %w", err)
+	}
 
-		err := e.runPipeline(ctx, siteID, userID, deployID, logger)
-		if logFile != nil {
-			logFile.Close()
-		}
-		if err != nil {
-			logger(fmt.Sprintf("Deployment failed: %v", err))
-			if ctx.Err() == context.Canceled {
-				db.UpdateDeploymentStatus(e.DB, deployID, "canceled", "")
-			} else {
-				db.UpdateDeploymentStatus(e.DB, deployID, "failed", "")
-			}
-		} else {
-			logger("Deployment successful")
-		}
-	}()
+	e.reportStatus(deployID, commitStatusPending, "Deployment queued")
+	e.emitDeploymentEvent(deployID, EventDeploymentCreated)
+	e.supersedeOlder(siteID, previewID, deployID)
+	e.wakeWorkers()
 
 	return db.GetDeploymentByID(e.DB, deployID)
 }
@@ -193,29 +208,73 @@ func (e *Engine) CancelDeployment(deployID string) error {
 	cancel, ok := e.deployments[deployID]
 	e.deploymentsMux.Unlock()
 
-	if !ok {
+	if ok {
+		cancel(nil)
+		return nil
+	}
+
+	canceled, err := db.CancelQueuedDeploymentJob(e.DB, deployID)
+	if err != nil {
+		return err
+	}
+	if !canceled {
 		return fmt.Errorf("deployment not found or not running")
 	}
 
-	cancel()
+	e.reportStatus(deployID, commitStatusError, "Deployment canceled")
+	e.emitDeploymentEvent(deployID, EventDeploymentCanceled)
+	e.closeLogFeed(deployID)
+	if stream := e.detachLogStream(deployID); stream != nil {
+		close(stream)
+	}
 	return nil
 }
 
-func (e *Engine) runPipeline(ctx context.Context, siteID, userID, deployID string, logger func(string)) error {
+func (e *Engine) runPipeline(ctx context.Context, siteID, userID, deployID string, buildLog *BuildLog) error {
+	logger := buildLog.Info
 
 	site, err := db.GetSiteByID(e.DB, userID, siteID)
 	if err != nil {
 		return err
 	}
 
-	logger(fmt.Sprintf("Starting deployment for site %s (%s)", site.Name, site.ID))
+	envVars := []string{}
+	if site.EnvText.Valid && site.EnvText.String != "" {
+		decryptedEnv := lib.Decrypt(site.EnvText.String)
+		envVars = parseEnvText(decryptedEnv)
+	}
+	secretKeys, _ := db.GetSiteSecretEnvKeys(e.DB, siteID)
+	buildLog.AddSecrets(secretEnvValues(envVars, secretKeys)...)
+
+	d, err := db.GetDeploymentByID(e.DB, deployID)
+	if err != nil {
+		return err
+	}
+	var preview *db.SitePreview
+	if d.PreviewID.Valid {
+		preview, err = db.GetSitePreview(e.DB, d.PreviewID.String)
+		if err == sql.ErrNoRows {
+			return errPreviewRemoved
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if preview != nil {
+		logger(fmt.Sprintf("Starting preview deployment of %s for site %s (%s)", preview.Branch, site.Name, site.ID))
+	} else {
+		logger(fmt.Sprintf("Starting deployment for site %s (%s)", site.Name, site.ID))
+	}
 
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
 
-	buildDir := filepath.Join(e.WorkDir, deployID)
+	jobDir := filepath.Join(e.WorkDir, deployID)
+	buildDir := filepath.Join(jobDir, "repo")
 
+	e.setStage(deployID, db.JobCloning)
+	buildLog.SetStage(StageClone)
 	logger("Cloning repository...")
 	if !site.GitURL.Valid {
 		return fmt.Errorf("site has no git url")
@@ -224,6 +283,7 @@ func (e *Engine) runPipeline(ctx context.Context, siteID, userID, deployID strin
 
 	ghToken, err := db.GetGitHubToken(e.DB, userID)
 	if err == nil && ghToken != "" && strings.Contains(repoURL, "github.com") {
+		buildLog.AddSecrets(ghToken)
 
 		if strings.HasPrefix(repoURL, "https://github.com/") {
 			logger("Injecting GitHub authentication token...")
@@ -240,8 +300,13 @@ func (e *Engine) runPipeline(ctx context.Context, siteID, userID, deployID strin
 	if site.GitBranch.Valid {
 		branch = site.GitBranch.String
 	}
+	environment := EnvironmentProduction
+	if preview != nil {
+		branch = preview.Branch
+		environment = EnvironmentPreview
+	}
 
-	err = GitClone(ctx, repoURL, branch, buildDir, 1, logger)
+	err = GitClone(ctx, repoURL, branch, buildDir, 1, buildLog)
 	if err != nil {
 		return fmt.Errorf("git clone failed: %w", err)
 	}
@@ -249,8 +314,10 @@ func (e *Engine) runPipeline(ctx context.Context, siteID, userID, deployID strin
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
+	commitSHA := ""
 	head, err := GitCurrentHead(buildDir)
 	if err == nil {
+		commitSHA = head.SHA
 
 		avatarURL := ""
 		if strings.Contains(site.GitURL.String, "github.com") {
@@ -291,22 +358,52 @@ func (e *Engine) runPipeline(ctx context.Context, siteID, userID, deployID strin
 
 		e.DB.Exec(`UPDATE deployments SET commitSha=?, commitMessage=?, commitAuthor=?, commitAvatar=? WHERE id=?`,
 			head.SHA, head.Message, head.Author, avatarURL, deployID)
+		if d.CommitSha.String != head.SHA {
+			e.reportStatus(deployID, commitStatusPending, "Building")
+		}
 	}
 
-	logger("Building project...")
+	siteDir := buildDir
+	if site.GitSubdir.Valid && strings.TrimSpace(site.GitSubdir.String) != "" {
+		siteDir, err = resolveWithin(buildDir, site.GitSubdir.String)
+		if err != nil {
+			return fmt.Errorf("invalid subdirectory: %w", err)
+		}
+		if info, err := os.Stat(siteDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("invalid subdirectory: %s is not a directory", site.GitSubdir.String)
+		}
+		logger(fmt.Sprintf("Building from subdirectory %s", strings.Trim(site.GitSubdir.String, "/")))
+	}
 
-	envVars := []string{}
-	if site.EnvText.Valid && site.EnvText.String != "" {
-		decryptedEnv := lib.Decrypt(site.EnvText.String)
-		envVars = parseEnvText(decryptedEnv)
+	e.setStage(deployID, db.JobBuilding)
+	buildLog.SetStage(StageBuild)
+	logger("Building project...")
+	if e.Executor != nil {
+		logger(fmt.Sprintf("Build sandbox: %s", e.Executor.Name()))
 	}
 
 	bs := &BuildSystem{
-		RootDir: buildDir,
-		Env:     envVars,
-		Logger:  logger,
-		Cache:   e.Cache,
-		SiteID:  siteID,
+		RootDir: siteDir,
+		RepoDir: buildDir,
+		HomeDir: filepath.Join(jobDir, "home"),
+		Vars: BuildVars{
+			SiteID:       siteID,
+			DeploymentID: deployID,
+			Branch:       branch,
+			CommitSHA:    commitSHA,
+			Environment:  environment,
+		},
+		Env:    envVars,
+		Log:    buildLog,
+		Cache:  e.Cache,
+		SiteID: siteID,
+
+		Executor:       e.Executor,
+		Timeout:        e.BuildTimeout,
+		MaxOutputBytes: e.MaxOutputBytes,
+	}
+	if site.OutputDir.Valid {
+		bs.OutputDir = site.OutputDir.String
 	}
 
 	customBuildCmd := ""
@@ -319,21 +416,79 @@ func (e *Engine) runPipeline(ctx context.Context, siteID, userID, deployID strin
 		return fmt.Errorf("build failed: %w", err)
 	}
 
-	fullOutputDir := filepath.Join(buildDir, outputDirName)
+	fullOutputDir := filepath.Join(siteDir, outputDirName)
 	if !fileExists(fullOutputDir) {
 		return fmt.Errorf("output directory %s not found", outputDirName)
 	}
 
+	publishedDir, _ := filepath.Rel(buildDir, fullOutputDir)
+	publishedDir = filepath.ToSlash(publishedDir)
+	logger(fmt.Sprintf("Publishing directory %s", publishedDir))
+	db.UpdateDeploymentOutputDir(e.DB, deployID, publishedDir)
+
 	logger("Build complete. Starting upload...")
 	db.UpdateDeploymentStatus(e.DB, deployID, "running", "")
 
+	e.setStage(deployID, db.JobUploading)
+	buildLog.SetStage(StageUpload)
 	logger("Uploading to storage...")
-	b2 := NewB2Client(e.B2KeyID, e.B2AppKey, e.B2BucketID)
-
-	prefix := fmt.Sprintf("sites/%s/%s", siteID, deployID)
 
 	files, _ := ListFilesRecursive(fullOutputDir)
-	logger(fmt.Sprintf("Found %d files to upload", len(files)))
+	manifest, sources, err := BuildManifest(fullOutputDir, files)
+	if err != nil {
+		return err
+	}
+
+	uniqueFiles := len(sources)
+
+	var prev *Manifest
+	if site.CurrentDeploymentID.Valid && site.CurrentDeploymentID.String != deployID {
+		prev, err = LoadManifest(e.Storage, siteID, site.CurrentDeploymentID.String)
+		if err != nil && !errors.Is(err, ErrObjectNotFound) {
+			logger(fmt.Sprintf("Warning: Failed to load previous manifest: %v", err))
+		}
+	}
+
+	compressed, reused, err := precompress(ctx, manifest, sources, filepath.Join(jobDir, "compressed"), prev)
+	if err != nil {
+		return fmt.Errorf("precompression failed: %w", err)
+	}
+	logger(fmt.Sprintf("Precompressed %d files (%d reused from the previous deployment)", compressed, reused))
+
+	records, err := manifest.Records()
+	if err != nil {
+		return err
+	}
+
+	// Recording our files and reading the site's known blobs under the site
+	// lock keeps the janitor from deleting a blob we then skip uploading.
+	unlockFiles := e.lockSite(siteID)
+	err = db.SaveDeploymentFiles(e.DB, deployID, records)
+	var uploaded []db.DeploymentFile
+	if err == nil {
+		uploaded, err = db.ListUploadedSiteFiles(e.DB, siteID, deployID)
+	}
+	unlockFiles()
+	if err != nil {
+		return fmt.Errorf("failed to record deployment files: %w", err)
+	}
+
+	known := map[string]bool{}
+	for _, f := range uploaded {
+		known[f.Hash] = true
+		for _, v := range ParseEncodings(f.Encodings) {
+			known[v.Hash] = true
+		}
+	}
+
+	var pending []string
+	for hash := range sources {
+		if !known[hash] {
+			pending = append(pending, hash)
+		}
+	}
+	logger(fmt.Sprintf("Found %d files (%d unique), uploading %d new objects, %d unchanged",
+		len(files), uniqueFiles, len(pending), len(sources)-len(pending)))
 
 	const maxConcurrency = 20
 	semaphore := make(chan struct{}, maxConcurrency)
@@ -341,7 +496,7 @@ func (e *Engine) runPipeline(ctx context.Context, siteID, userID, deployID strin
 	var uploadErr error
 	var errMutex sync.Mutex
 
-	for _, fPath := range files {
+	for _, hash := range pending {
 		if ctx.Err() != nil {
 			break
 		}
@@ -349,7 +504,7 @@ func (e *Engine) runPipeline(ctx context.Context, siteID, userID, deployID strin
 		wg.Add(1)
 		semaphore <- struct{}{}
 
-		go func(path string) {
+		go func(hash string) {
 			defer wg.Done()
 			defer func() { <-semaphore }()
 
@@ -360,11 +515,11 @@ func (e *Engine) runPipeline(ctx context.Context, siteID, userID, deployID strin
 			}
 			errMutex.Unlock()
 
-			relPath, _ := filepath.Rel(fullOutputDir, path)
-			key := fmt.Sprintf("%s/%s", prefix, relPath)
-			key = filepath.ToSlash(key)
+			src := sources[hash]
+			relPath, _ := filepath.Rel(fullOutputDir, src.Path)
+			relPath = filepath.ToSlash(relPath)
 
-			content, err := ioutil.ReadFile(path)
+			f, err := os.Open(src.Path)
 			if err != nil {
 				errMutex.Lock()
 				if uploadErr == nil {
@@ -373,31 +528,9 @@ func (e *Engine) runPipeline(ctx context.Context, siteID, userID, deployID strin
 				errMutex.Unlock()
 				return
 			}
+			defer f.Close()
 
-			contentType := "application/octet-stream"
-			if strings.HasSuffix(key, ".html") {
-				contentType = "text/html"
-			}
-			if strings.HasSuffix(key, ".css") {
-				contentType = "text/css"
-			}
-			if strings.HasSuffix(key, ".js") {
-				contentType = "application/javascript"
-			}
-			if strings.HasSuffix(key, ".json") {
-				contentType = "application/json"
-			}
-			if strings.HasSuffix(key, ".png") {
-				contentType = "image/png"
-			}
-			if strings.HasSuffix(key, ".jpg") {
-				contentType = "image/jpeg"
-			}
-			if strings.HasSuffix(key, ".svg") {
-				contentType = "image/svg+xml"
-			}
-
-			err = b2.UploadFile(key, content, contentType)
+			err = e.Storage.Upload(BlobKey(siteID, hash), f, src.Size, src.ContentType)
 			if err != nil {
 				errMutex.Lock()
 				if uploadErr == nil {
@@ -405,7 +538,7 @@ func (e *Engine) runPipeline(ctx context.Context, siteID, userID, deployID strin
 				}
 				errMutex.Unlock()
 			}
-		}(fPath)
+		}(hash)
 	}
 
 	wg.Wait()
@@ -416,24 +549,34 @@ func (e *Engine) runPipeline(ctx context.Context, siteID, userID, deployID strin
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
+
+	if err := SaveManifest(e.Storage, siteID, deployID, manifest); err != nil {
+		return fmt.Errorf("manifest upload failed: %w", err)
+	}
 	logger("Upload complete")
 
-	logger("Updating routing...")
-	cf := NewCloudflareClient(e.CFAccountID, e.CFNamespaceID, e.CFToken)
-	rootDomain := os.Getenv("FSD_EDGE_ROOT_DOMAIN")
+	e.setStage(deployID, db.JobRouting)
+	buildLog.SetStage(StageRouting)
 
-	if site.Domain != "" {
+	unlock := e.lockSite(siteID)
+	defer unlock()
 
-		routingKey := site.Domain
+	if preview != nil {
+		return e.routePreview(site, preview.ID, deployID, logger)
+	}
 
-		if rootDomain != "" && strings.HasSuffix(site.Domain, "."+rootDomain) {
-			routingKey = strings.TrimSuffix(site.Domain, "."+rootDomain)
-		} else if rootDomain != "" && site.Domain == rootDomain {
+	if older, err := db.IsOlderThanCurrentDeployment(e.DB, siteID, deployID); err != nil {
+		logger(fmt.Sprintf("Warning: Failed to compare with the live deployment: %v", err))
+	} else if older {
+		logger("A newer deployment is already live, not updating routing")
+		return errSuperseded
+	}
 
-			routingKey = "@"
-		}
+	logger("Updating routing...")
+	rootDomain := os.Getenv("FSD_EDGE_ROOT_DOMAIN")
 
-		err = cf.EnsureRouting(routingKey, siteID, deployID)
+	if site.Domain != "" {
+		err = e.EnsureRouting(siteRoutingKey(site.Domain), siteID, deployID)
 		if err != nil {
 			return fmt.Errorf("routing update failed: %w", err)
 		}
@@ -441,13 +584,9 @@ func (e *Engine) runPipeline(ctx context.Context, siteID, userID, deployID strin
 
 	customDomains, _ := db.ListCustomDomains(e.DB, siteID)
 	for _, cd := range customDomains {
-
-		hostname := strings.ToLower(strings.TrimSpace(cd.Hostname))
-		hostname = strings.TrimPrefix(hostname, "http://")
-		hostname = strings.TrimPrefix(hostname, "https://")
-
+		hostname := customDomainHost(cd.Hostname)
 		logger(fmt.Sprintf("Updating routing for custom domain: %s", hostname))
-		err = cf.EnsureRouting(hostname, siteID, deployID)
+		err = e.EnsureRouting(hostname, siteID, deployID)
 		if err != nil {
 			logger(fmt.Sprintf("Failed to update routing for %s: %v", hostname, err))
 		}
@@ -455,7 +594,7 @@ func (e *Engine) runPipeline(ctx context.Context, siteID, userID, deployID strin
 
 	if site.Domain == "" && len(customDomains) == 0 {
 
-		err = cf.EnsureRouting("", siteID, deployID)
+		err = e.EnsureRouting("", siteID, deployID)
 		if err != nil {
 			return fmt.Errorf("routing update failed: %w", err)
 		}
@@ -551,8 +690,6 @@ func parseEnvText(envText string) []string {
 
 func (e *Engine) CleanupSite(siteID string, userID string) error {
 
-	cf := NewCloudflareClient(e.CFAccountID, e.CFNamespaceID, e.CFToken)
-
 	site, err := db.GetSiteByID(e.DB, userID, siteID)
 	if err == nil && site != nil {
 
@@ -561,23 +698,54 @@ func (e *Engine) CleanupSite(siteID string, userID string) error {
 		if rootDomain != "" && strings.HasSuffix(site.Domain, "."+rootDomain) {
 			routingKey = strings.TrimSuffix(site.Domain, "."+rootDomain)
 		}
-		cf.RemoveRouting(routingKey, site.ID, site.Domain)
+		e.RemoveRouting(routingKey, site.ID, site.Domain)
 	}
 
 	customDomains, _ := db.ListCustomDomains(e.DB, siteID)
 	for _, cd := range customDomains {
-		cf.RemoveRouting("", siteID, cd.Hostname)
+		e.RemoveRouting("", siteID, cd.Hostname)
 
 	}
 
-	b2 := NewB2Client(e.B2KeyID, e.B2AppKey, e.B2BucketID)
-
-	prefix := fmt.Sprintf("sites/%s/", siteID)
+	previews, _ := db.ListSitePreviews(e.DB, siteID)
+	for _, p := range previews {
+		e.Router.UnmapPreview(p.Host)
+	}
 
-	err = b2.DeleteFilesWithPrefix(prefix)
+	files, err := db.ListSiteDeploymentFiles(e.DB, siteID)
 	if err != nil {
+		return fmt.Errorf("failed to list deployment files: %w", err)
+	}
+
+	seen := map[string]bool{}
+	var keys []string
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, f := range files {
+		add(ManifestKey(siteID, f.DeploymentID))
+		add(BlobKey(siteID, f.Hash))
+		for _, v := range ParseEncodings(f.Encodings) {
+			add(BlobKey(siteID, v.Hash))
+		}
+	}
+
+	if err := e.Storage.Delete(keys); err != nil {
 		return fmt.Errorf("failed to delete files: %w", err)
 	}
 
+	legacy, err := db.ListDeploymentsWithoutFiles(e.DB, siteID)
+	if err != nil {
+		return fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, deployID := range legacy {
+		if err := e.Storage.DeletePrefix(fmt.Sprintf("sites/%s/%s/", siteID, deployID)); err != nil {
+			return fmt.Errorf("failed to delete files: %w", err)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,70 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+func hostPath() string {
+	if p := os.Getenv("PATH"); p != "" {
+		return p
+	}
+	return defaultPath
+}
+
+func gitEnv() []string {
+	return []string{
+		"PATH=" + hostPath(),
+		"LANG=C.UTF-8",
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_CONFIG_GLOBAL=" + os.DevNull,
+		"GIT_ASKPASS=true",
+		"SSH_ASKPASS=true",
+	}
+}
+
+const (
+	EnvironmentProduction = "production"
+	EnvironmentPreview    = "preview"
+)
+
+type BuildVars struct {
+	SiteID       string
+	DeploymentID string
+	Branch       string
+	CommitSHA    string
+	Environment  string
+}
+
+func (v BuildVars) Env() []string {
+	return []string{
+		"BOOP=1",
+		"BOOP_SITE_ID=" + v.SiteID,
+		"BOOP_DEPLOYMENT_ID=" + v.DeploymentID,
+		"BOOP_GIT_BRANCH=" + v.Branch,
+		"BOOP_GIT_COMMIT_SHA=" + v.CommitSHA,
+		"BOOP_ENVIRONMENT=" + v.Environment,
+	}
+}
+
+func buildEnv(homeDir string, vars BuildVars, siteEnv []string, nodeEnv string) []string {
+	env := []string{
+		"PATH=" + hostPath(),
+		"HOME=" + homeDir,
+		"TMPDIR=" + filepath.Join(homeDir, "tmp"),
+		"LANG=C.UTF-8",
+		"CI=true",
+	}
+	if nodeEnv != "" {
+		env = append(env, "NODE_ENV="+nodeEnv)
+	}
+	env = append(env, vars.Env()...)
+	return append(env, siteEnv...)
+}
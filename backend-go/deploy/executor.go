@@ -0,0 +1,217 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	ExecutorUnsafeLocal = "unsafe-local"
+	ExecutorBwrap       = "bwrap"
+)
+
+const commandWaitDelay = 5 * time.Second
+
+var errOutputLimit = errors.New("build output exceeded the maximum size")
+
+type ResourceLimits struct {
+	MemoryMB   int
+	CPUSeconds int
+	MaxPids    int
+	Network    bool
+}
+
+type ExecSpec struct {
+	Dir      string
+	Env      []string
+	Writable []string
+	Name     string
+	Args     []string
+}
+
+type Executor interface {
+	Name() string
+	Command(ctx context.Context, spec ExecSpec) (*exec.Cmd, error)
+}
+
+func NewExecutor(kind string, limits ResourceLimits) (Executor, error) {
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "", ExecutorUnsafeLocal:
+		return localExecutor{}, nil
+	case ExecutorBwrap:
+		bwrap, err := exec.LookPath("bwrap")
+		if err != nil {
+			return nil, fmt.Errorf("bwrap sandbox requested but bubblewrap is not installed: %w", err)
+		}
+		b := &bwrapExecutor{bwrap: bwrap, limits: limits}
+		if limits.MemoryMB > 0 || limits.MaxPids > 0 {
+			if systemdRun, err := exec.LookPath("systemd-run"); err != nil {
+				log.Printf("[Sandbox] systemd-run not found: BUILD_MAX_PIDS is not enforced and BUILD_MEMORY_MB is best-effort (RLIMIT_DATA)")
+			} else if err := probeSystemdScope(systemdRun); err != nil {
+				log.Printf("[Sandbox] systemd-run cannot create a scope (%v): BUILD_MAX_PIDS is not enforced and BUILD_MEMORY_MB is best-effort (RLIMIT_DATA)", err)
+			} else {
+				b.systemdRun = systemdRun
+			}
+		}
+		if limits.CPUSeconds > 0 || (b.systemdRun == "" && limits.MemoryMB > 0) {
+			b.prlimit, err = exec.LookPath("prlimit")
+			if err != nil {
+				return nil, fmt.Errorf("build limits require prlimit (util-linux): %w", err)
+			}
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unknown build sandbox %q", kind)
+	}
+}
+
+// systemdBusEnv is what systemd-run needs to reach the user manager. It is
+// not part of the build environment, so it is added for systemd-run only and
+// unset again inside the sandbox.
+var systemdBusEnv = []string{"XDG_RUNTIME_DIR", "DBUS_SESSION_BUS_ADDRESS"}
+
+func systemdScopeArgs() []string {
+	args := []string{"--scope", "--quiet", "--collect"}
+	if os.Geteuid() != 0 {
+		args = append(args, "--user")
+	}
+	return args
+}
+
+func systemdEnv(env []string) []string {
+	out := append([]string{}, env...)
+	for _, key := range systemdBusEnv {
+		if v, ok := os.LookupEnv(key); ok {
+			out = append(out, key+"="+v)
+		}
+	}
+	return out
+}
+
+func probeSystemdScope(systemdRun string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	args := append(systemdScopeArgs(), "--", "true")
+	cmd := exec.CommandContext(ctx, systemdRun, args...)
+	cmd.Env = systemdEnv([]string{"PATH=" + os.Getenv("PATH")})
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%w: %s", err, strings.ReplaceAll(msg, "\n", "; "))
+		}
+		return err
+	}
+	return nil
+}
+
+type localExecutor struct{}
+
+func (localExecutor) Name() string {
+	return ExecutorUnsafeLocal
+}
+
+func (localExecutor) Command(ctx context.Context, spec ExecSpec) (*exec.Cmd, error) {
+	cmd := exec.CommandContext(ctx, spec.Name, spec.Args...)
+	cmd.Dir = spec.Dir
+	cmd.Env = spec.Env
+	cmd.WaitDelay = commandWaitDelay
+	return cmd, nil
+}
+
+type bwrapExecutor struct {
+	bwrap      string
+	systemdRun string
+	prlimit    string
+	limits     ResourceLimits
+}
+
+var sandboxReadOnlyPaths = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/opt",
+	"/etc/alternatives", "/etc/ssl", "/etc/ca-certificates", "/etc/pki",
+	"/etc/resolv.conf", "/etc/hosts", "/etc/nsswitch.conf", "/etc/localtime",
+	"/etc/passwd", "/etc/group",
+}
+
+func (b *bwrapExecutor) Name() string {
+	return ExecutorBwrap
+}
+
+func (b *bwrapExecutor) Command(ctx context.Context, spec ExecSpec) (*exec.Cmd, error) {
+	args := []string{"--die-with-parent", "--new-session", "--unshare-all"}
+	if b.systemdRun != "" {
+		for _, key := range systemdBusEnv {
+			args = append(args, "--unsetenv", key)
+		}
+	}
+	if b.limits.Network {
+		args = append(args, "--share-net")
+	}
+
+	for _, p := range sandboxReadOnlyPaths {
+		info, err := os.Lstat(p)
+		if err != nil {
+			continue
+		}
+		if info.Mode()&os.ModeSymlink != 0 && !strings.HasPrefix(p, "/etc/") {
+			target, err := os.Readlink(p)
+			if err != nil {
+				continue
+			}
+			args = append(args, "--symlink", target, p)
+			continue
+		}
+		args = append(args, "--ro-bind", p, p)
+	}
+
+	args = append(args, "--proc", "/proc", "--dev", "/dev", "--tmpfs", "/tmp")
+
+	for _, p := range spec.Writable {
+		if err := os.MkdirAll(p, 0755); err != nil {
+			return nil, err
+		}
+		args = append(args, "--bind", p, p)
+	}
+	args = append(args, "--chdir", spec.Dir, "--")
+
+	if b.prlimit != "" {
+		args = append(args, b.prlimit)
+		if b.systemdRun == "" && b.limits.MemoryMB > 0 {
+			args = append(args, fmt.Sprintf("--data=%d", int64(b.limits.MemoryMB)*1024*1024))
+		}
+		if b.limits.CPUSeconds > 0 {
+			args = append(args, fmt.Sprintf("--cpu=%d", b.limits.CPUSeconds))
+		}
+		args = append(args, "--")
+	}
+	args = append(args, spec.Name)
+	args = append(args, spec.Args...)
+
+	name, env := b.bwrap, spec.Env
+	if b.systemdRun != "" {
+		scope := systemdScopeArgs()
+		if b.limits.MemoryMB > 0 {
+			scope = append(scope, "-p", fmt.Sprintf("MemoryMax=%dM", b.limits.MemoryMB), "-p", "MemorySwapMax=0")
+		}
+		if b.limits.MaxPids > 0 {
+			scope = append(scope, "-p", fmt.Sprintf("TasksMax=%d", b.limits.MaxPids))
+		}
+		args = append(append(scope, "--", b.bwrap), args...)
+		name, env = b.systemdRun, systemdEnv(spec.Env)
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = spec.Dir
+	cmd.Env = env
+	cmd.WaitDelay = commandWaitDelay
+	return cmd, nil
+}
@@ -7,17 +7,19 @@ package deploy
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 func ensureDir(path string) error {
 	return os.MkdirAll(path, 0755)
 }
 
-func GitClone(ctx context.Context, repoURL, branch, targetDir string, depth int, logger func(string)) error {
+func GitClone(ctx context.Context, repoURL, branch, targetDir string, depth int, buildLog *BuildLog) error {
 	if err := os.RemoveAll(targetDir); err != nil {
 		return fmt.Errorf("failed to clear target dir: %w", err)
 	}
@@ -32,7 +34,7 @@ func GitClone(ctx context.Context, repoURL, branch, targetDir string, depth int,
 	args = append(args, repoURL, targetDir)
 
 	cmd := exec.CommandContext(ctx, "git", args...)
-	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Env = gitEnv()
 
 	stdout, _ := cmd.StdoutPipe()
 	stderr, _ := cmd.StderrPipe()
@@ -41,51 +43,22 @@ func GitClone(ctx context.Context, repoURL, branch, targetDir string, depth int,
 		return err
 	}
 
-	sanitize := func(s string) string {
-
-		if strings.Contains(s, "@github.com") {
-			parts := strings.Split(s, "@github.com")
-			if len(parts) > 1 {
-
-				lastSpace := strings.LastIndex(parts[0], " ")
-				if lastSpace != -1 {
-					return parts[0][:lastSpace+1] + "***" + "@github.com" + parts[1]
-				}
-
-				lastSlash := strings.LastIndex(parts[0], "//")
-				if lastSlash != -1 {
-					return parts[0][:lastSlash+2] + "***" + "@github.com" + parts[1]
-				}
-			}
-		}
-		return s
-	}
+	stdoutLog := buildLog.Stream(StreamStdout)
+	stderrLog := buildLog.Stream(StreamStderr)
 
+	var wg sync.WaitGroup
+	wg.Add(2)
 	go func() {
-		buf := make([]byte, 1024)
-		for {
-			n, err := stdout.Read(buf)
-			if n > 0 && logger != nil {
-				logger(sanitize(string(buf[:n])))
-			}
-			if err != nil {
-				break
-			}
-		}
+		defer wg.Done()
+		io.Copy(stdoutLog, stdout)
+		stdoutLog.Close()
 	}()
-
 	go func() {
-		buf := make([]byte, 1024)
-		for {
-			n, err := stderr.Read(buf)
-			if n > 0 && logger != nil {
-				logger(sanitize(string(buf[:n])))
-			}
-			if err != nil {
-				break
-			}
-		}
+		defer wg.Done()
+		io.Copy(stderrLog, stderr)
+		stderrLog.Close()
 	}()
+	wg.Wait()
 
 	return cmd.Wait()
 }
@@ -93,6 +66,7 @@ func GitClone(ctx context.Context, repoURL, branch, targetDir string, depth int,
 func GitCheckout(targetDir, ref string) error {
 	cmd := exec.Command("git", "checkout", ref)
 	cmd.Dir = targetDir
+	cmd.Env = gitEnv()
 	return cmd.Run()
 }
 
@@ -106,6 +80,7 @@ func GitCurrentHead(targetDir string) (*CommitInfo, error) {
 
 	shaCmd := exec.Command("git", "rev-parse", "HEAD")
 	shaCmd.Dir = targetDir
+	shaCmd.Env = gitEnv()
 	shaOut, err := shaCmd.Output()
 	if err != nil {
 		return nil, err
@@ -113,10 +88,12 @@ func GitCurrentHead(targetDir string) (*CommitInfo, error) {
 
 	msgCmd := exec.Command("git", "log", "-1", "--pretty=%s")
 	msgCmd.Dir = targetDir
+	msgCmd.Env = gitEnv()
 	msgOut, _ := msgCmd.Output()
 
 	authCmd := exec.Command("git", "log", "-1", "--pretty=%an <%ae>")
 	authCmd.Dir = targetDir
+	authCmd.Env = gitEnv()
 	authOut, _ := authCmd.Output()
 
 	return &CommitInfo{
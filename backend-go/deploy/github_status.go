@@ -0,0 +1,135 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"boop-cat/db"
+)
+
+const (
+	commitStatusPending = "pending"
+	commitStatusSuccess = "success"
+	commitStatusFailure = "failure"
+	commitStatusError   = "error"
+
+	commitStatusQueueSize = 256
+	maxStatusDescription  = 140
+)
+
+type commitStatus struct {
+	DeploymentID string
+	State        string
+	Description  string
+}
+
+func githubRepo(gitURL string) (owner, repo string, ok bool) {
+	if !strings.HasPrefix(gitURL, "https://github.com/") {
+		return "", "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(gitURL, "https://github.com/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], strings.TrimSuffix(parts[1], ".git"), true
+}
+
+func deploymentLogsURL(siteID, deployID string) string {
+	base := strings.TrimRight(os.Getenv("PUBLIC_URL"), "/")
+	if base == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/dashboard/site/%s?logs=%s", base, url.PathEscape(siteID), url.QueryEscape(deployID))
+}
+
+func (e *Engine) reportStatus(deployID, state, description string) {
+	select {
+	case e.statuses <- commitStatus{DeploymentID: deployID, State: state, Description: description}:
+	default:
+		log.Printf("[Deploy %s] Commit status queue is full, dropping %s status", deployID, state)
+	}
+}
+
+func (e *Engine) statusWorker() {
+	for s := range e.statuses {
+		if err := e.postCommitStatus(s); err != nil {
+			log.Printf("[Deploy %s] Failed to update GitHub commit status: %v", s.DeploymentID, err)
+		}
+	}
+}
+
+func (e *Engine) postCommitStatus(s commitStatus) error {
+	d, err := db.GetDeploymentByID(e.DB, s.DeploymentID)
+	if err != nil || !d.CommitSha.Valid || d.CommitSha.String == "" {
+		return nil
+	}
+	site, err := db.GetSiteByIDAdmin(e.DB, d.SiteID)
+	if err != nil || !site.GitURL.Valid {
+		return nil
+	}
+	owner, repo, ok := githubRepo(site.GitURL.String)
+	if !ok {
+		return nil
+	}
+	token, err := db.GetGitHubToken(e.DB, d.UserID)
+	if err != nil || token == "" {
+		return nil
+	}
+
+	targetURL := deploymentLogsURL(site.ID, d.ID)
+	if s.State == commitStatusSuccess && d.URL.Valid {
+		targetURL = d.URL.String
+	}
+
+	statusContext := "boop.cat/" + site.Name
+	if d.PreviewID.Valid {
+		statusContext += " (preview)"
+	}
+
+	description := s.Description
+	if runes := []rune(description); len(runes) > maxStatusDescription {
+		description = string(runes[:maxStatusDescription-3]) + "..."
+	}
+
+	payload := map[string]string{
+		"state":       s.State,
+		"description": description,
+		"context":     statusContext,
+	}
+	if targetURL != "" {
+		payload["target_url"] = targetURL
+	}
+	body, _ := json.Marshal(payload)
+
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/statuses/%s", owner, repo, d.CommitSha.String)
+	req, err := http.NewRequest("POST", apiURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("github returned %s", resp.Status)
+	}
+	return nil
+}
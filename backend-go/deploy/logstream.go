@@ -0,0 +1,116 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+)
+
+const logFeedBuffer = 256
+
+func (e *Engine) SubscribeLogs(deployID string) (<-chan LogRecord, func()) {
+	ch := make(chan LogRecord, logFeedBuffer)
+
+	e.logFeedsMu.Lock()
+	feed, ok := e.logFeeds[deployID]
+	if !ok {
+		feed = make(map[chan LogRecord]struct{})
+		e.logFeeds[deployID] = feed
+	}
+	feed[ch] = struct{}{}
+	e.logFeedsMu.Unlock()
+
+	return ch, func() {
+		e.logFeedsMu.Lock()
+		defer e.logFeedsMu.Unlock()
+		feed, ok := e.logFeeds[deployID]
+		if !ok {
+			return
+		}
+		if _, ok := feed[ch]; ok {
+			delete(feed, ch)
+			close(ch)
+		}
+		if len(feed) == 0 {
+			delete(e.logFeeds, deployID)
+		}
+	}
+}
+
+func (e *Engine) publishLog(deployID string, line LogRecord) {
+	e.logFeedsMu.Lock()
+	defer e.logFeedsMu.Unlock()
+
+	for ch := range e.logFeeds[deployID] {
+		select {
+		case ch <- line:
+		default:
+			delete(e.logFeeds[deployID], ch)
+			close(ch)
+		}
+	}
+}
+
+func (e *Engine) closeLogFeed(deployID string) {
+	e.logFeedsMu.Lock()
+	defer e.logFeedsMu.Unlock()
+
+	for ch := range e.logFeeds[deployID] {
+		close(ch)
+	}
+	delete(e.logFeeds, deployID)
+}
+
+func ReadLogRecords(path string, after int, emit func(LogRecord) error) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return after, nil
+		}
+		return after, err
+	}
+	defer f.Close()
+
+	structured := strings.HasSuffix(path, ".jsonl")
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	n := 0
+	for scanner.Scan() {
+		n++
+		if n <= after {
+			continue
+		}
+		var rec LogRecord
+		if !structured || json.Unmarshal(scanner.Bytes(), &rec) != nil {
+			rec = legacyLogRecord(scanner.Text())
+		}
+		rec.N = n
+		if err := emit(rec); err != nil {
+			return n, err
+		}
+	}
+	if n < after {
+		n = after
+	}
+	return n, scanner.Err()
+}
+
+func legacyLogRecord(line string) LogRecord {
+	rec := LogRecord{Stream: StreamSystem, Text: line}
+	if strings.HasPrefix(line, "[") {
+		if i := strings.Index(line, "] "); i > 0 {
+			if _, err := time.Parse(time.RFC3339, line[1:i]); err == nil {
+				rec.Time = line[1:i]
+				rec.Text = line[i+2:]
+			}
+		}
+	}
+	rec.Level = lineLevel(rec.Text)
+	return rec
+}
@@ -0,0 +1,152 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"boop-cat/db"
+)
+
+const manifestVersion = 1
+
+type ManifestVariant struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+type ManifestEntry struct {
+	Hash        string                     `json:"hash"`
+	Size        int64                      `json:"size"`
+	ContentType string                     `json:"contentType"`
+	Encodings   map[string]ManifestVariant `json:"encodings,omitempty"`
+}
+
+type blobSource struct {
+	Path        string
+	Size        int64
+	ContentType string
+}
+
+type Manifest struct {
+	Version int                      `json:"version"`
+	Files   map[string]ManifestEntry `json:"files"`
+}
+
+func ManifestKey(siteID, deployID string) string {
+	return fmt.Sprintf("sites/%s/manifests/%s.json", siteID, deployID)
+}
+
+func BlobKey(siteID, hash string) string {
+	return fmt.Sprintf("sites/%s/blobs/%s", siteID, hash)
+}
+
+func LoadManifest(storage Storage, siteID, deployID string) (*Manifest, error) {
+	body, _, err := storage.Open(ManifestKey(siteID, deployID))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var m Manifest
+	if err := json.NewDecoder(body).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if m.Files == nil {
+		m.Files = map[string]ManifestEntry{}
+	}
+	return &m, nil
+}
+
+func SaveManifest(storage Storage, siteID, deployID string, m *Manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return storage.Upload(ManifestKey(siteID, deployID), bytes.NewReader(data), int64(len(data)), "application/json")
+}
+
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func BuildManifest(root string, files []string) (*Manifest, map[string]blobSource, error) {
+	m := &Manifest{Version: manifestVersion, Files: make(map[string]ManifestEntry, len(files))}
+	sources := make(map[string]blobSource)
+
+	for _, path := range files {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		rel = filepath.ToSlash(rel)
+
+		hash, size, err := hashFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("hash failed for %s: %w", rel, err)
+		}
+
+		contentType := ContentTypeFor(rel)
+		m.Files[rel] = ManifestEntry{Hash: hash, Size: size, ContentType: contentType}
+		if _, ok := sources[hash]; !ok {
+			sources[hash] = blobSource{Path: path, Size: size, ContentType: contentType}
+		}
+	}
+
+	return m, sources, nil
+}
+
+func (m *Manifest) Records() ([]db.DeploymentFile, error) {
+	paths := make([]string, 0, len(m.Files))
+	for p := range m.Files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	records := make([]db.DeploymentFile, 0, len(paths))
+	for _, p := range paths {
+		entry := m.Files[p]
+		rec := db.DeploymentFile{Path: p, Size: entry.Size, Hash: entry.Hash, ContentType: entry.ContentType}
+		if len(entry.Encodings) > 0 {
+			data, err := json.Marshal(entry.Encodings)
+			if err != nil {
+				return nil, err
+			}
+			rec.Encodings = string(data)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func ParseEncodings(encodings string) map[string]ManifestVariant {
+	if encodings == "" {
+		return nil
+	}
+	var variants map[string]ManifestVariant
+	if err := json.Unmarshal([]byte(encodings), &variants); err != nil {
+		return nil
+	}
+	return variants
+}
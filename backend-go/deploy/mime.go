@@ -0,0 +1,172 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"mime"
+	"path"
+	"strings"
+)
+
+var mimeTypes = map[string]string{
+	".html":        "text/html",
+	".htm":         "text/html",
+	".shtml":       "text/html",
+	".xhtml":       "application/xhtml+xml",
+	".css":         "text/css",
+	".js":          "text/javascript",
+	".mjs":         "text/javascript",
+	".cjs":         "text/javascript",
+	".jsx":         "text/javascript",
+	".ts":          "text/plain",
+	".tsx":         "text/plain",
+	".mts":         "text/plain",
+	".cts":         "text/plain",
+	".map":         "application/json",
+	".json":        "application/json",
+	".jsonld":      "application/ld+json",
+	".webmanifest": "application/manifest+json",
+	".xml":         "application/xml",
+	".xsl":         "application/xslt+xml",
+	".rss":         "application/rss+xml",
+	".atom":        "application/atom+xml",
+	".txt":         "text/plain",
+	".text":        "text/plain",
+	".md":          "text/markdown",
+	".markdown":    "text/markdown",
+	".csv":         "text/csv",
+	".tsv":         "text/tab-separated-values",
+	".ics":         "text/calendar",
+	".vcf":         "text/vcard",
+	".vtt":         "text/vtt",
+	".srt":         "application/x-subrip",
+	".yaml":        "application/yaml",
+	".yml":         "application/yaml",
+	".toml":        "application/toml",
+	".wasm":        "application/wasm",
+	".pdf":         "application/pdf",
+	".zip":         "application/zip",
+	".gz":          "application/gzip",
+	".tar":         "application/x-tar",
+	".7z":          "application/x-7z-compressed",
+	".rar":         "application/vnd.rar",
+	".bin":         "application/octet-stream",
+	".exe":         "application/octet-stream",
+	".dmg":         "application/octet-stream",
+	".apk":         "application/vnd.android.package-archive",
+	".epub":        "application/epub+zip",
+	".doc":         "application/msword",
+	".docx":        "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":         "application/vnd.ms-excel",
+	".xlsx":        "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".ppt":         "application/vnd.ms-powerpoint",
+	".pptx":        "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":         "application/vnd.oasis.opendocument.text",
+	".rtf":         "application/rtf",
+	".png":         "image/png",
+	".apng":        "image/apng",
+	".jpg":         "image/jpeg",
+	".jpeg":        "image/jpeg",
+	".jfif":        "image/jpeg",
+	".pjpeg":       "image/jpeg",
+	".gif":         "image/gif",
+	".webp":        "image/webp",
+	".avif":        "image/avif",
+	".heic":        "image/heic",
+	".heif":        "image/heif",
+	".jxl":         "image/jxl",
+	".bmp":         "image/bmp",
+	".tif":         "image/tiff",
+	".tiff":        "image/tiff",
+	".ico":         "image/x-icon",
+	".cur":         "image/x-icon",
+	".svg":         "image/svg+xml",
+	".woff":        "font/woff",
+	".woff2":       "font/woff2",
+	".ttf":         "font/ttf",
+	".otf":         "font/otf",
+	".eot":         "application/vnd.ms-fontobject",
+	".mp3":         "audio/mpeg",
+	".m4a":         "audio/mp4",
+	".aac":         "audio/aac",
+	".wav":         "audio/wav",
+	".ogg":         "audio/ogg",
+	".oga":         "audio/ogg",
+	".opus":        "audio/opus",
+	".flac":        "audio/flac",
+	".weba":        "audio/webm",
+	".mid":         "audio/midi",
+	".midi":        "audio/midi",
+	".mp4":         "video/mp4",
+	".m4v":         "video/mp4",
+	".webm":        "video/webm",
+	".ogv":         "video/ogg",
+	".mov":         "video/quicktime",
+	".avi":         "video/x-msvideo",
+	".mkv":         "video/x-matroska",
+	".mpeg":        "video/mpeg",
+	".mpg":         "video/mpeg",
+	".m3u8":        "application/vnd.apple.mpegurl",
+	".mpd":         "application/dash+xml",
+	".glb":         "model/gltf-binary",
+	".gltf":        "model/gltf+json",
+	".usdz":        "model/vnd.usdz+zip",
+	".pem":         "application/x-pem-file",
+	".crt":         "application/x-x509-ca-cert",
+	".swf":         "application/x-shockwave-flash",
+}
+
+func ContentTypeFor(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	contentType, ok := mimeTypes[ext]
+	if !ok {
+		contentType = mime.TypeByExtension(ext)
+		if i := strings.Index(contentType, ";"); i >= 0 {
+			contentType = strings.TrimSpace(contentType[:i])
+		}
+	}
+	if contentType == "" {
+		return "application/octet-stream"
+	}
+	if isTextType(contentType) {
+		contentType += "; charset=utf-8"
+	}
+	return contentType
+}
+
+func mediaType(contentType string) string {
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+func isTextType(contentType string) bool {
+	t := mediaType(contentType)
+	if strings.HasPrefix(t, "text/") {
+		return true
+	}
+	switch t {
+	case "application/json", "application/ld+json", "application/manifest+json",
+		"application/xml", "application/xhtml+xml", "application/xslt+xml",
+		"application/rss+xml", "application/atom+xml", "application/yaml",
+		"application/toml", "application/x-subrip", "image/svg+xml", "model/gltf+json",
+		"application/vnd.apple.mpegurl", "application/dash+xml":
+		return true
+	}
+	return false
+}
+
+func isCompressible(contentType string) bool {
+	if isTextType(contentType) {
+		return true
+	}
+	switch mediaType(contentType) {
+	case "application/wasm", "application/vnd.ms-fontobject", "font/ttf", "font/otf",
+		"image/x-icon", "image/bmp", "application/x-pem-file":
+		return true
+	}
+	return false
+}
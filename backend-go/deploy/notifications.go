@@ -0,0 +1,235 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"boop-cat/db"
+	"boop-cat/lib"
+)
+
+const (
+	defaultNotifyThrottle = time.Hour
+	logExcerptLines       = 20
+	maxLogExcerptBytes    = 1500
+	maxDiscordContent     = 2000
+)
+
+type notification struct {
+	Event        string `json:"event"`
+	SiteID       string `json:"siteId"`
+	SiteName     string `json:"siteName"`
+	DeploymentID string `json:"deploymentId"`
+	Title        string `json:"title"`
+	Message      string `json:"message"`
+	LogExcerpt   string `json:"logExcerpt,omitempty"`
+	URL          string `json:"url,omitempty"`
+	CreatedAt    string `json:"createdAt"`
+}
+
+func logExcerpt(path string) string {
+	var lines []string
+	ReadLogRecords(path, 0, func(rec LogRecord) error {
+		lines = append(lines, rec.String())
+		if len(lines) > logExcerptLines {
+			lines = lines[1:]
+		}
+		return nil
+	})
+	return tailExcerpt(strings.Join(lines, "\n"), maxLogExcerptBytes)
+}
+
+// tailExcerpt keeps at most max bytes from the end of s, starting at a line
+// boundary when there is one and never in the middle of a character.
+func tailExcerpt(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	s = s[len(s)-max:]
+	if i := strings.IndexByte(s, '\n'); i >= 0 && i < len(s)-1 {
+		return s[i+1:]
+	}
+	for len(s) > 0 && !utf8.RuneStart(s[0]) {
+		s = s[1:]
+	}
+	return s
+}
+
+func (e *Engine) notifyDeploymentResult(deployID string, failed bool) {
+	d, err := db.GetDeploymentByID(e.DB, deployID)
+	if err != nil || d.PreviewID.Valid {
+		return
+	}
+	site, err := db.GetSiteByIDAdmin(e.DB, d.SiteID)
+	if err != nil {
+		return
+	}
+
+	n := e.throttleNotification(site, d, failed)
+	if n == nil {
+		return
+	}
+
+	settings, err := db.GetNotificationSettings(e.DB, site.UserID)
+	if err != nil || !settings.Wants(n.Event) {
+		return
+	}
+	e.sendNotification(site.UserID, settings, n)
+}
+
+func (e *Engine) throttleNotification(site *db.Site, d *db.Deployment, failed bool) *notification {
+	e.notifyMu.Lock()
+	defer e.notifyMu.Unlock()
+
+	state, err := db.GetSiteNotificationState(e.DB, site.ID)
+	if err != nil {
+		log.Printf("[Notify] Failed to load notification state for %s: %v", site.ID, err)
+		return nil
+	}
+	if !failed && !state.Failing {
+		return nil
+	}
+
+	throttle := e.NotifyThrottle
+	if throttle <= 0 {
+		throttle = defaultNotifyThrottle
+	}
+
+	now := time.Now().UTC()
+	stamp := sql.NullString{String: now.Format(time.RFC3339), Valid: true}
+	n := &notification{
+		SiteID:       site.ID,
+		SiteName:     site.Name,
+		DeploymentID: d.ID,
+		URL:          deploymentLogsURL(site.ID, d.ID),
+		CreatedAt:    now.Format(time.RFC3339),
+	}
+
+	if failed {
+		state.Failures++
+		n.Event = db.NotifyDeploymentFailed
+		n.LogExcerpt = logExcerpt(d.LogsPath.String)
+		if !state.Failing {
+			state.Failing = true
+			state.FailingSince = stamp
+			n.Title = fmt.Sprintf("Deployment failed for %s", site.Name)
+			n.Message = fmt.Sprintf("The latest deployment of %s failed. The previous deployment is still live.", site.Name)
+		} else if last, err := time.Parse(time.RFC3339, state.LastNotifiedAt.String); err != nil || now.Sub(last) >= throttle {
+			n.Title = fmt.Sprintf("%s is still failing", site.Name)
+			n.Message = fmt.Sprintf("%d deployments of %s have failed since %s, %d of them since the last notification.",
+				state.Failures, site.Name, state.FailingSince.String, state.Suppressed+1)
+		} else {
+			state.Suppressed++
+			n = nil
+		}
+		if n != nil {
+			state.Suppressed = 0
+			state.LastNotifiedAt = stamp
+		}
+	} else {
+		n.Event = db.NotifyDeploymentRecovered
+		n.Title = fmt.Sprintf("Deployment recovered for %s", site.Name)
+		n.Message = fmt.Sprintf("%s deployed successfully after %d failed deployments.", site.Name, state.Failures)
+		if state.Failures == 1 {
+			n.Message = fmt.Sprintf("%s deployed successfully after a failed deployment.", site.Name)
+		}
+		*state = db.SiteNotificationState{SiteID: site.ID}
+	}
+
+	if err := db.SaveSiteNotificationState(e.DB, state); err != nil {
+		log.Printf("[Notify] Failed to save notification state for %s: %v", site.ID, err)
+	}
+	return n
+}
+
+func (e *Engine) sendNotification(userID string, settings *db.NotificationSettings, n *notification) {
+	if settings.EmailEnabled {
+		if user, err := db.GetUserByID(e.DB, userID); err == nil && user.EmailVerified && user.Email != "" {
+			if err := lib.SendDeploymentNotificationEmail(user.Email, n.Title+" - boop.cat", n.Title, n.Message, n.LogExcerpt, n.URL); err != nil {
+				log.Printf("[Notify] Email to %s failed: %v", userID, err)
+			}
+		}
+	}
+
+	if url := lib.Decrypt(settings.DiscordWebhookURL); url != "" {
+		if err := postNotification(url, map[string]string{"content": discordContent(n)}); err != nil {
+			log.Printf("[Notify] Discord webhook for %s failed: %v", userID, err)
+		}
+	}
+
+	if url := lib.Decrypt(settings.SlackWebhookURL); url != "" {
+		if err := postNotification(url, map[string]string{"text": slackText(n)}); err != nil {
+			log.Printf("[Notify] Slack webhook for %s failed: %v", userID, err)
+		}
+	}
+
+	if url := lib.Decrypt(settings.WebhookURL); url != "" {
+		if err := postNotification(url, n); err != nil {
+			log.Printf("[Notify] Webhook for %s failed: %v", userID, err)
+		}
+	}
+}
+
+func discordContent(n *notification) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s**\n%s\n", n.Title, n.Message)
+	if n.URL != "" {
+		fmt.Fprintf(&b, "%s\n", n.URL)
+	}
+	if n.LogExcerpt != "" {
+		room := maxDiscordContent - b.Len() - len("```\n\n```")
+		excerpt := strings.ReplaceAll(n.LogExcerpt, "```", "'''")
+		if room <= 0 {
+			return b.String()
+		}
+		excerpt = tailExcerpt(excerpt, room)
+		fmt.Fprintf(&b, "```\n%s\n```", excerpt)
+	}
+	return b.String()
+}
+
+func slackText(n *notification) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s*\n%s", n.Title, n.Message)
+	if n.URL != "" {
+		fmt.Fprintf(&b, "\n<%s|View deployment>", n.URL)
+	}
+	if n.LogExcerpt != "" {
+		fmt.Fprintf(&b, "\n```%s```", strings.ReplaceAll(n.LogExcerpt, "```", "'''"))
+	}
+	return b.String()
+}
+
+func postNotification(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "boop.cat-notifications")
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return nil
+}
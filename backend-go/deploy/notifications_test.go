@@ -0,0 +1,36 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTailExcerpt(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		max  int
+		want string
+	}{
+		{"short", "one\ntwo", 20, "one\ntwo"},
+		{"cut at next line", "first line\nsecond\nthird", 12, "third"},
+		{"cut inside last line", "first\nabcdefgh", 5, "defgh"},
+		{"cut inside a character", "xxé€", 4, "€"},
+		{"trailing newline", "aaaa\nbb\n", 3, "bb\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tailExcerpt(tt.in, tt.max)
+			if got != tt.want {
+				t.Errorf("tailExcerpt(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+			}
+			if !utf8.ValidString(got) || len(got) > tt.max {
+				t.Errorf("tailExcerpt(%q, %d) = %q is not valid or too long", tt.in, tt.max, got)
+			}
+		})
+	}
+}
@@ -26,6 +26,7 @@ type PreviewResult struct {
 func (e *Engine) PreviewGitRepo(gitURL string) (*PreviewResult, error) {
 
 	cmd := exec.Command("git", "ls-remote", gitURL, "HEAD")
+	cmd.Env = gitEnv()
 
 	if err := cmd.Run(); err != nil {
 		return nil, fmt.Errorf("GIT_CLONE_FAILED: Repo not found or private")
@@ -35,6 +36,7 @@ func (e *Engine) PreviewGitRepo(gitURL string) (*PreviewResult, error) {
 	defer os.RemoveAll(tmpDir)
 
 	cloneCmd := exec.Command("git", "clone", "--depth", "1", gitURL, tmpDir)
+	cloneCmd.Env = gitEnv()
 	if out, err := cloneCmd.CombinedOutput(); err != nil {
 		return nil, fmt.Errorf("GIT_CLONE_FAILED: %v - %s", err, string(out))
 	}
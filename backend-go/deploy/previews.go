@@ -0,0 +1,207 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/nrednav/cuid2"
+
+	"boop-cat/db"
+)
+
+const (
+	previewSeparator = "--"
+	maxHostLabel     = 63
+)
+
+var (
+	ErrPreviewsUnavailable     = errors.New("previews need a site subdomain under the edge root domain")
+	ErrPreviewProductionBranch = errors.New("the production branch cannot be deployed as a preview")
+
+	errPreviewRemoved = errors.New("preview was removed")
+
+	previewLabelPattern = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+func previewRootDomain() string {
+	return strings.ToLower(strings.TrimLeft(os.Getenv("FSD_EDGE_ROOT_DOMAIN"), "."))
+}
+
+func PreviewURL(host string) string {
+	return fmt.Sprintf("https://%s.%s", host, previewRootDomain())
+}
+
+func ProductionBranch(site *db.Site) string {
+	if site.GitBranch.Valid && site.GitBranch.String != "" {
+		return site.GitBranch.String
+	}
+	return "main"
+}
+
+func ReservedSiteDomain(domain string) bool {
+	sub := parseSubdomain(strings.TrimSpace(domain), previewRootDomain())
+	return strings.Contains(sub, previewSeparator)
+}
+
+func previewHost(site *db.Site, kind, branch string, prNumber int) (string, error) {
+	root := previewRootDomain()
+	domain := strings.ToLower(site.Domain)
+	if root == "" || !strings.HasSuffix(domain, "."+root) {
+		return "", ErrPreviewsUnavailable
+	}
+	siteLabel := strings.TrimSuffix(domain, "."+root)
+	if siteLabel == "" || strings.Contains(siteLabel, ".") {
+		return "", ErrPreviewsUnavailable
+	}
+
+	label := fmt.Sprintf("pr-%d", prNumber)
+	if kind == db.PreviewBranch {
+		label = strings.Trim(previewLabelPattern.ReplaceAllString(strings.ToLower(branch), "-"), "-")
+		if label == "" {
+			label = "branch"
+		}
+	}
+
+	max := maxHostLabel - len(previewSeparator) - len(siteLabel)
+	if len(label) > max {
+		sum := sha1.Sum([]byte(branch))
+		keep := max - 7
+		if keep < 1 {
+			return "", ErrPreviewsUnavailable
+		}
+		label = strings.TrimRight(label[:keep], "-") + "-" + hex.EncodeToString(sum[:])[:6]
+	}
+	return label + previewSeparator + siteLabel, nil
+}
+
+func (e *Engine) DeployPreview(siteID, userID, kind, branch string, prNumber int, logStream chan<- string) (*db.Deployment, error) {
+	site, err := db.GetSiteByID(e.DB, userID, siteID)
+	if err != nil {
+		return nil, err
+	}
+	if kind == db.PreviewBranch && branch == ProductionBranch(site) {
+		return nil, ErrPreviewProductionBranch
+	}
+
+	host, err := previewHost(site, kind, branch, prNumber)
+	if err != nil {
+		return nil, err
+	}
+	preview, err := db.UpsertSitePreview(e.DB, cuid2.Generate(), siteID, kind, branch, prNumber, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save preview: %w", err)
+	}
+
+	return e.queueDeployment(siteID, userID, preview, logStream)
+}
+
+func (e *Engine) routePreview(site *db.Site, previewID, deployID string, logger func(string)) error {
+	preview, err := db.GetSitePreview(e.DB, previewID)
+	if err == sql.ErrNoRows {
+		logger("The preview was removed, not updating routing")
+		return errPreviewRemoved
+	} else if err != nil {
+		return err
+	}
+
+	if older, err := db.IsOlderThanPreviewDeployment(e.DB, previewID, deployID); err != nil {
+		logger(fmt.Sprintf("Warning: Failed to compare with the live preview: %v", err))
+	} else if older {
+		logger("A newer deployment of this preview is already live, not updating routing")
+		return errSuperseded
+	}
+
+	logger(fmt.Sprintf("Updating preview routing for %s...", preview.Host))
+	if err := e.Router.MapPreview(preview.Host, site.ID, deployID); err != nil {
+		return fmt.Errorf("routing update failed: %w", err)
+	}
+
+	finalURL := PreviewURL(preview.Host)
+	db.UpdateDeploymentStatus(e.DB, deployID, "running", finalURL)
+	if err := db.SetSitePreviewDeployment(e.DB, previewID, deployID); err != nil {
+		return fmt.Errorf("failed to update preview: %w", err)
+	}
+
+	if err := db.StopOtherPreviewDeployments(e.DB, previewID, deployID); err != nil {
+		logger(fmt.Sprintf("Warning: Failed to stop other preview deployments: %v", err))
+	}
+
+	logger(fmt.Sprintf("Preview available at %s", finalURL))
+	logger("Deployment successful!")
+	return nil
+}
+
+func (e *Engine) cancelPreviewBuilds(siteID, previewID string) {
+	skipped, err := db.SupersedeQueuedJobs(e.DB, siteID, previewID, "")
+	if err != nil {
+		log.Printf("[Deploy] Failed to skip queued preview deployments: %v", err)
+	}
+	for _, id := range skipped {
+		e.reportStatus(id, commitStatusError, "Preview was removed")
+		e.emitDeploymentEvent(id, EventDeploymentCanceled)
+		e.closeLogFeed(id)
+		if stream := e.detachLogStream(id); stream != nil {
+			stream <- "Preview was removed"
+			close(stream)
+		}
+	}
+
+	active, err := db.ListActiveJobsForSite(e.DB, siteID, previewID, "")
+	if err != nil {
+		log.Printf("[Deploy] Failed to list in-progress preview deployments: %v", err)
+		return
+	}
+	for _, id := range active {
+		e.deploymentsMux.Lock()
+		cancel, ok := e.deployments[id]
+		e.deploymentsMux.Unlock()
+		if ok {
+			cancel(errPreviewRemoved)
+		}
+	}
+}
+
+func (e *Engine) TeardownPreview(previewID string) error {
+	preview, err := db.GetSitePreview(e.DB, previewID)
+	if err != nil {
+		return err
+	}
+
+	e.cancelPreviewBuilds(preview.SiteID, preview.ID)
+
+	unlock := e.lockSite(preview.SiteID)
+	if err := e.Router.UnmapPreview(preview.Host); err != nil {
+		unlock()
+		return fmt.Errorf("routing update failed: %w", err)
+	}
+	err = db.DeleteSitePreview(e.DB, preview.ID)
+	if err == nil {
+		err = db.StopPreviewDeployments(e.DB, preview.ID)
+	}
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	deployments, err := db.ListPreviewDeployments(e.DB, preview.ID)
+	if err != nil {
+		return err
+	}
+	if _, err := e.collectSite(preview.SiteID, deployments, false); err != nil {
+		return fmt.Errorf("failed to delete preview files: %w", err)
+	}
+
+	log.Printf("[Deploy] Removed preview %s of site %s", preview.Host, preview.SiteID)
+	return nil
+}
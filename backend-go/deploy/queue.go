@@ -0,0 +1,232 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"boop-cat/db"
+)
+
+const (
+	defaultMaxConcurrent = 4
+	defaultMaxPerUser    = 2
+	maxJobAttempts       = 2
+	jobPollInterval      = 2 * time.Second
+)
+
+var errSuperseded = errors.New("superseded by a newer deployment")
+
+func (e *Engine) Start() {
+	e.startOnce.Do(func() {
+		requeued, failed, err := db.RecoverInterruptedJobs(e.DB, maxJobAttempts)
+		if err != nil {
+			log.Printf("[Deploy] Failed to recover interrupted jobs: %v", err)
+		} else if requeued > 0 || failed > 0 {
+			log.Printf("[Deploy] Recovered interrupted deployments: %d requeued, %d failed", requeued, failed)
+		}
+
+		workers := e.MaxConcurrent
+		if workers <= 0 {
+			workers = defaultMaxConcurrent
+		}
+
+		go e.statusWorker()
+		go e.webhookWorker()
+
+		host, _ := os.Hostname()
+		for i := 0; i < workers; i++ {
+			go e.worker(fmt.Sprintf("%s-%d-%d", host, os.Getpid(), i))
+		}
+	})
+}
+
+func (e *Engine) QueuePositions() map[string]int {
+	positions, err := db.QueuePositions(e.DB, e.MaxPerUser)
+	if err != nil {
+		log.Printf("[Deploy] Failed to compute queue positions: %v", err)
+		return map[string]int{}
+	}
+	return positions
+}
+
+func (e *Engine) wakeWorkers() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (e *Engine) worker(workerID string) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := db.ClaimDeploymentJob(e.DB, workerID, e.MaxPerUser)
+		if err == nil {
+			e.runJob(job)
+			continue
+		}
+		if err != sql.ErrNoRows {
+			log.Printf("[Deploy] Worker %s failed to claim job: %v", workerID, err)
+		}
+
+		select {
+		case <-e.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Engine) lockSite(siteID string) func() {
+	e.deploymentsMux.Lock()
+	mu, ok := e.siteLocks[siteID]
+	if !ok {
+		mu = &sync.Mutex{}
+		e.siteLocks[siteID] = mu
+	}
+	e.deploymentsMux.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
+
+func (e *Engine) supersedeOlder(siteID, previewID, deployID string) {
+	skipped, err := db.SupersedeQueuedJobs(e.DB, siteID, previewID, deployID)
+	if err != nil {
+		log.Printf("[Deploy %s] Failed to supersede queued deployments: %v", deployID, err)
+	}
+	for _, id := range skipped {
+		log.Printf("[Deploy %s] Skipping queued deployment %s, superseded", deployID, id)
+		e.closeLogFeed(id)
+		e.reportStatus(id, commitStatusError, "Superseded by a newer deployment")
+		e.emitDeploymentEvent(id, EventDeploymentCanceled)
+		if stream := e.detachLogStream(id); stream != nil {
+			stream <- "Superseded by a newer deployment"
+			close(stream)
+		}
+	}
+
+	active, err := db.ListActiveJobsForSite(e.DB, siteID, previewID, deployID)
+	if err != nil {
+		log.Printf("[Deploy %s] Failed to list in-progress deployments: %v", deployID, err)
+		return
+	}
+	for _, id := range active {
+		e.deploymentsMux.Lock()
+		cancel, ok := e.deployments[id]
+		e.deploymentsMux.Unlock()
+		if ok {
+			log.Printf("[Deploy %s] Canceling in-progress deployment %s, superseded", deployID, id)
+			cancel(errSuperseded)
+		}
+	}
+}
+
+func (e *Engine) detachLogStream(deployID string) chan<- string {
+	e.deploymentsMux.Lock()
+	defer e.deploymentsMux.Unlock()
+
+	stream, ok := e.logStreams[deployID]
+	if !ok {
+		return nil
+	}
+	delete(e.logStreams, deployID)
+	return stream
+}
+
+func (e *Engine) setStage(deployID, state string) {
+	if err := db.UpdateDeploymentJobState(e.DB, deployID, state); err != nil {
+		log.Printf("[Deploy %s] Failed to update job state to %s: %v", deployID, state, err)
+	}
+}
+
+func (e *Engine) runJob(job *db.DeploymentJob) {
+	deployID := job.DeploymentID
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	e.deploymentsMux.Lock()
+	e.deployments[deployID] = cancel
+	logStream := e.logStreams[deployID]
+	e.deploymentsMux.Unlock()
+
+	defer func() {
+		e.deploymentsMux.Lock()
+		delete(e.deployments, deployID)
+		e.deploymentsMux.Unlock()
+		cancel(nil)
+		if stream := e.detachLogStream(deployID); stream != nil {
+			close(stream)
+		}
+		e.closeLogFeed(deployID)
+		e.wakeWorkers()
+	}()
+
+	db.UpdateDeploymentStatus(e.DB, deployID, "building", "")
+	e.emitDeploymentEvent(deployID, EventDeploymentBuilding)
+
+	logsDir := filepath.Join(e.WorkDir, "logs")
+	os.MkdirAll(logsDir, 0755)
+	logsPath := filepath.Join(logsDir, deployID+".jsonl")
+
+	db.UpdateDeploymentLogs(e.DB, deployID, logsPath)
+
+	buildLog, err := OpenBuildLog(logsPath, func(rec LogRecord) {
+		log.Printf("[Deploy %s] %s", deployID, rec.Text)
+		e.publishLog(deployID, rec)
+		if logStream != nil {
+			logStream <- rec.Text
+		}
+	})
+	if err != nil {
+		log.Printf("[Deploy %s] Failed to open build log: %v", deployID, err)
+	}
+
+	if job.Attempts > 1 {
+		buildLog.Info(fmt.Sprintf("Resuming interrupted deployment (attempt %d of %d)", job.Attempts, maxJobAttempts))
+	}
+
+	err = e.runPipeline(ctx, job.SiteID, job.UserID, deployID, buildLog)
+	os.RemoveAll(filepath.Join(e.WorkDir, deployID))
+
+	if err != nil {
+		buildLog.Error(fmt.Sprintf("Deployment failed: %v", err))
+		buildLog.Close()
+		reason := buildLog.Redact(err.Error())
+		if errors.Is(err, errSuperseded) || errors.Is(context.Cause(ctx), errSuperseded) {
+			db.UpdateDeploymentStatus(e.DB, deployID, "superseded", "")
+			db.FinishDeploymentJob(e.DB, deployID, db.JobSuperseded, errSuperseded.Error())
+			e.reportStatus(deployID, commitStatusError, "Superseded by a newer deployment")
+			e.emitDeploymentEvent(deployID, EventDeploymentCanceled)
+		} else if ctx.Err() == context.Canceled || errors.Is(err, errPreviewRemoved) {
+			db.UpdateDeploymentStatus(e.DB, deployID, "canceled", "")
+			db.FinishDeploymentJob(e.DB, deployID, db.JobCanceled, reason)
+			e.reportStatus(deployID, commitStatusError, "Deployment canceled")
+			e.emitDeploymentEvent(deployID, EventDeploymentCanceled)
+		} else {
+			db.UpdateDeploymentStatus(e.DB, deployID, "failed", "")
+			db.FinishDeploymentJob(e.DB, deployID, db.JobFailed, reason)
+			e.reportStatus(deployID, commitStatusFailure, "Deployment failed: "+reason)
+			e.emitDeploymentEvent(deployID, EventDeploymentFailed)
+			go e.notifyDeploymentResult(deployID, true)
+		}
+		return
+	}
+
+	buildLog.Info("Deployment successful")
+	buildLog.Close()
+	db.FinishDeploymentJob(e.DB, deployID, db.JobDone, "")
+	e.reportStatus(deployID, commitStatusSuccess, "Deployment succeeded")
+	e.emitDeploymentEvent(deployID, EventDeploymentSucceeded)
+	go e.notifyDeploymentResult(deployID, false)
+}
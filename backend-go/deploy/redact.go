@@ -0,0 +1,125 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	redactedMask        = "***"
+	minSecretValueLen   = 4
+	minDetectedValueLen = 8
+	maxTokenMatchLen    = 1024
+)
+
+var secretKeyPattern = regexp.MustCompile(`(?i)(SECRET|TOKEN|PASSWORD|PASSWD|PASS|PWD|API_?KEY|ACCESS_?KEY|PRIVATE|CREDENTIAL|AUTH|SIGNING|DSN|WEBHOOK|SALT|COOKIE|SESSION)`)
+
+var tokenPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/\s@]+@`), "${1}" + redactedMask + "@"},
+	{regexp.MustCompile(`(?i)(authorization:\s*(?:bearer|basic|token)\s+)\S+`), "${1}" + redactedMask},
+	{regexp.MustCompile(`(?i)(bearer\s+)[a-z0-9._~+/-]{16,}=*`), "${1}" + redactedMask},
+	{regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{30,}`), redactedMask},
+	{regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{30,}`), redactedMask},
+	{regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}`), redactedMask},
+	{regexp.MustCompile(`\bnpm_[A-Za-z0-9]{36}\b`), redactedMask},
+	{regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), redactedMask},
+	{regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`), redactedMask},
+	{regexp.MustCompile(`\b[sr]k_(?:live|test)_[A-Za-z0-9]{16,}`), redactedMask},
+	{regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`), redactedMask},
+	{regexp.MustCompile(`\b(?:whsec|dh)_[A-Za-z0-9]{20,}`), redactedMask},
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`), redactedMask},
+	{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`), redactedMask},
+}
+
+type Redactor struct {
+	secrets  []string
+	replacer *strings.Replacer
+}
+
+func (r *Redactor) Add(values ...string) {
+	changed := false
+	for _, value := range values {
+		for _, line := range strings.Split(value, "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) < minSecretValueLen || r.has(line) {
+				continue
+			}
+			r.secrets = append(r.secrets, line)
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+	pairs := make([]string, 0, len(r.secrets)*2)
+	for _, s := range r.secrets {
+		pairs = append(pairs, s, redactedMask)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+}
+
+func (r *Redactor) has(value string) bool {
+	for _, s := range r.secrets {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) Redact(s string) string {
+	if r.replacer != nil {
+		s = r.replacer.Replace(s)
+	}
+	for _, p := range tokenPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+// MaxLen bounds how far back a partially written secret can start, so a
+// writer that has to cut a long line knows how many bytes to hold back.
+func (r *Redactor) MaxLen() int {
+	if len(r.secrets) > 0 && len(r.secrets[0]) > maxTokenMatchLen {
+		return len(r.secrets[0])
+	}
+	return maxTokenMatchLen
+}
+
+func LooksSecretEnvKey(key string) bool {
+	return secretKeyPattern.MatchString(key)
+}
+
+func secretEnvValues(envVars []string, markedKeys []string) []string {
+	var values []string
+	for _, kv := range envVars {
+		idx := strings.Index(kv, "=")
+		if idx <= 0 {
+			continue
+		}
+		key, value := kv[:idx], kv[idx+1:]
+		if containsKey(markedKeys, key) || (LooksSecretEnvKey(key) && len(value) >= minDetectedValueLen) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,253 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"boop-cat/db"
+)
+
+const (
+	retentionExpired   = "expired"
+	retentionAbandoned = "abandoned"
+	retentionPreview   = "preview"
+)
+
+type RetentionItem struct {
+	SiteID       string `json:"siteId"`
+	DeploymentID string `json:"deploymentId"`
+	Status       string `json:"status"`
+	CreatedAt    string `json:"createdAt"`
+	Reason       string `json:"reason"`
+	Legacy       bool   `json:"legacy"`
+	Objects      int    `json:"objects"`
+	Bytes        int64  `json:"bytes"`
+}
+
+type RetentionReport struct {
+	Keep        int             `json:"keep"`
+	DryRun      bool            `json:"dryRun"`
+	Deployments []RetentionItem `json:"deployments"`
+	Objects     int             `json:"objects"`
+	Bytes       int64           `json:"bytes"`
+	Errors      []string        `json:"errors,omitempty"`
+}
+
+// Abandoned deployments are swept even when RetentionKeep is 0.
+func (e *Engine) StartJanitor() {
+	interval := e.RetentionInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			report, err := e.RunRetention(e.RetentionKeep, false)
+			if err != nil {
+				log.Printf("[Janitor] Retention run failed: %v", err)
+			} else {
+				if len(report.Deployments) > 0 {
+					log.Printf("[Janitor] Collected %d deployments, deleted %d objects (%d bytes)",
+						len(report.Deployments), report.Objects, report.Bytes)
+				}
+				for _, msg := range report.Errors {
+					log.Printf("[Janitor] %s", msg)
+				}
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func (e *Engine) RunRetention(keep int, dryRun bool) (*RetentionReport, error) {
+	report := &RetentionReport{Keep: keep, DryRun: dryRun, Deployments: []RetentionItem{}}
+
+	var candidates []db.Deployment
+	if keep > 0 {
+		expired, err := db.ListExpiredDeployments(e.DB, keep)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, expired...)
+	}
+	abandoned, err := db.ListAbandonedDeployments(e.DB)
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(candidates, abandoned...)
+
+	bySite := map[string][]db.Deployment{}
+	var order []string
+	for _, d := range candidates {
+		if _, ok := bySite[d.SiteID]; !ok {
+			order = append(order, d.SiteID)
+		}
+		bySite[d.SiteID] = append(bySite[d.SiteID], d)
+	}
+
+	for _, siteID := range order {
+		items, err := e.collectSite(siteID, bySite[siteID], dryRun)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("site %s: %v", siteID, err))
+		}
+		for _, item := range items {
+			report.Deployments = append(report.Deployments, item)
+			report.Objects += item.Objects
+			report.Bytes += item.Bytes
+		}
+	}
+
+	return report, nil
+}
+
+func stillCollectable(d *db.Deployment, live map[string]bool, reason string) bool {
+	if live[d.ID] || d.Pinned {
+		return false
+	}
+	switch reason {
+	case retentionExpired:
+		return d.Status == "stopped" && !d.PreviewID.Valid
+	case retentionPreview:
+		return d.Status == "stopped" && d.PreviewID.Valid
+	}
+	return d.Status == "failed" || d.Status == "canceled" || d.Status == "superseded"
+}
+
+func (e *Engine) collectSite(siteID string, candidates []db.Deployment, dryRun bool) ([]RetentionItem, error) {
+	if !dryRun {
+		unlock := e.lockSite(siteID)
+		defer unlock()
+	}
+
+	site, err := db.GetSiteByIDAdmin(e.DB, siteID)
+	if err != nil {
+		return nil, err
+	}
+
+	previews, err := db.ListSitePreviews(e.DB, siteID)
+	if err != nil {
+		return nil, err
+	}
+	live := map[string]bool{site.CurrentDeploymentID.String: true}
+	for _, p := range previews {
+		if p.DeploymentID != nil {
+			live[*p.DeploymentID] = true
+		}
+	}
+
+	doomed := map[string]RetentionItem{}
+	var ids []string
+	for _, c := range candidates {
+		reason := retentionExpired
+		if c.Status != "stopped" {
+			reason = retentionAbandoned
+		} else if c.PreviewID.Valid {
+			reason = retentionPreview
+		}
+
+		d, err := db.GetDeploymentByID(e.DB, c.ID)
+		if err != nil || !stillCollectable(d, live, reason) {
+			continue
+		}
+		doomed[d.ID] = RetentionItem{
+			SiteID:       siteID,
+			DeploymentID: d.ID,
+			Status:       d.Status,
+			CreatedAt:    d.CreatedAt,
+			Reason:       reason,
+			Legacy:       true,
+		}
+		ids = append(ids, d.ID)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	files, err := db.ListSiteDeploymentFiles(e.DB, siteID)
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := map[string]bool{}
+	for _, f := range files {
+		if _, ok := doomed[f.DeploymentID]; ok {
+			continue
+		}
+		referenced[f.Hash] = true
+		for _, v := range ParseEncodings(f.Encodings) {
+			referenced[v.Hash] = true
+		}
+	}
+
+	keys := map[string][]string{}
+	scheduled := map[string]bool{}
+	schedule := func(deployID, hash string, size int64) {
+		if referenced[hash] || scheduled[hash] {
+			return
+		}
+		scheduled[hash] = true
+		keys[deployID] = append(keys[deployID], BlobKey(siteID, hash))
+		item := doomed[deployID]
+		item.Objects++
+		item.Bytes += size
+		doomed[deployID] = item
+	}
+
+	for _, f := range files {
+		item, ok := doomed[f.DeploymentID]
+		if !ok {
+			continue
+		}
+		if item.Legacy {
+			item.Legacy = false
+			item.Objects++
+			doomed[f.DeploymentID] = item
+			keys[f.DeploymentID] = append(keys[f.DeploymentID], ManifestKey(siteID, f.DeploymentID))
+		}
+		schedule(f.DeploymentID, f.Hash, f.Size)
+		for _, v := range ParseEncodings(f.Encodings) {
+			schedule(f.DeploymentID, v.Hash, v.Size)
+		}
+	}
+
+	var items []RetentionItem
+	for _, id := range ids {
+		item := doomed[id]
+		prefix := fmt.Sprintf("sites/%s/%s/", siteID, id)
+
+		if item.Legacy {
+			objects, err := e.Storage.List(prefix)
+			if err != nil {
+				return items, err
+			}
+			for _, obj := range objects {
+				item.Objects++
+				item.Bytes += obj.Size
+			}
+		}
+
+		if !dryRun {
+			if item.Legacy {
+				err = e.Storage.DeletePrefix(prefix)
+			} else {
+				err = e.Storage.Delete(keys[id])
+			}
+			if err != nil {
+				return items, fmt.Errorf("failed to delete files for %s: %w", id, err)
+			}
+			if err := db.ExpireDeployment(e.DB, id, item.Reason != retentionAbandoned); err != nil {
+				return items, err
+			}
+		}
+
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/nrednav/cuid2"
+
+	"boop-cat/db"
+)
+
+const (
+	RollbackViaSession = "session"
+	RollbackViaAPI     = "api"
+)
+
+var (
+	ErrNoPreviousDeployment    = errors.New("no previous deployment to roll back to")
+	ErrDeploymentNotPromotable = errors.New("only previously successful deployments can be promoted")
+	ErrDeploymentFilesMissing  = errors.New("deployment files are no longer in storage")
+)
+
+func (e *Engine) deploymentAvailable(siteID, deployID string) (bool, error) {
+	_, err := e.Storage.Stat(ManifestKey(siteID, deployID))
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, ErrObjectNotFound) {
+		return false, err
+	}
+
+	legacy, err := e.Storage.List(fmt.Sprintf("sites/%s/%s/", siteID, deployID))
+	if err != nil {
+		return false, err
+	}
+	return len(legacy) > 0, nil
+}
+
+// routeSite points the site's hostnames at deployID, mapping any host that a
+// stop removed. The returned func puts routing back the way it was.
+func (e *Engine) routeSite(site *db.Site, deployID string) (func(), error) {
+	active, err := e.Router.ActiveDeployment(site.ID)
+	if err != nil {
+		return func() {}, err
+	}
+
+	type hostRoute struct{ host, siteID string }
+	var changed []hostRoute
+	restore := func() {
+		for _, r := range changed {
+			var err error
+			if r.siteID == "" {
+				err = e.Router.UnmapHost(r.host)
+			} else {
+				err = e.Router.MapHost(r.host, r.siteID)
+			}
+			if err != nil {
+				log.Printf("[Deploy %s] Failed to restore routing for %s after a failed promotion: %v", deployID, r.host, err)
+			}
+		}
+		var err error
+		if active != "" {
+			err = e.Router.SetActiveDeployment(site.ID, active)
+		} else {
+			err = e.Router.ClearActiveDeployment(site.ID)
+		}
+		if err != nil {
+			log.Printf("[Deploy %s] Failed to restore routing after a failed promotion: %v", deployID, err)
+		}
+	}
+
+	var hosts []string
+	if site.Domain != "" {
+		hosts = append(hosts, siteRoutingKey(site.Domain))
+	}
+	customDomains, err := db.ListCustomDomains(e.DB, site.ID)
+	if err != nil {
+		return restore, err
+	}
+	for _, cd := range customDomains {
+		hosts = append(hosts, customDomainHost(cd.Hostname))
+	}
+
+	for _, host := range hosts {
+		current, err := e.Router.LookupHost(host)
+		if err != nil {
+			return restore, err
+		}
+		if current != site.ID {
+			changed = append(changed, hostRoute{host, current})
+		}
+		if err := e.EnsureRouting(host, site.ID, deployID); err != nil {
+			return restore, err
+		}
+	}
+	if len(hosts) == 0 {
+		if err := e.EnsureRouting("", site.ID, deployID); err != nil {
+			return restore, err
+		}
+	}
+	return restore, nil
+}
+
+func (e *Engine) Promote(siteID, deployID, actorID, via string) (*db.Deployment, error) {
+	unlock := e.lockSite(siteID)
+	defer unlock()
+
+	site, err := db.GetSiteByIDAdmin(e.DB, siteID)
+	if err != nil {
+		return nil, err
+	}
+
+	var target *db.Deployment
+	if deployID == "" {
+		target, err = db.GetPreviousDeployment(e.DB, siteID, site.CurrentDeploymentID.String)
+		if err == sql.ErrNoRows {
+			return nil, ErrNoPreviousDeployment
+		}
+	} else {
+		target, err = db.GetDeploymentByID(e.DB, deployID)
+		if err == sql.ErrNoRows || (err == nil && target.SiteID != siteID) {
+			return nil, sql.ErrNoRows
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if target.PreviewID.Valid || (target.Status != "running" && target.Status != "stopped") {
+		return nil, ErrDeploymentNotPromotable
+	}
+
+	ok, err := e.deploymentAvailable(siteID, target.ID)
+	if err != nil {
+		return nil, fmt.Errorf("storage check failed: %w", err)
+	}
+	if !ok {
+		return nil, ErrDeploymentFilesMissing
+	}
+
+	restore, err := e.routeSite(site, target.ID)
+	if err != nil {
+		restore()
+		return nil, fmt.Errorf("routing update failed: %w", err)
+	}
+
+	previous, err := db.PromoteDeployment(e.DB, cuid2.Generate(), siteID, target.ID, actorID, via)
+	if err != nil {
+		restore()
+		return nil, err
+	}
+
+	log.Printf("[Deploy %s] Promoted by %s via %s (previously %s)", target.ID, actorID, via, previous)
+	return db.GetDeploymentByID(e.DB, target.ID)
+}
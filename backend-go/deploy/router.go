@@ -0,0 +1,407 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"boop-cat/db"
+)
+
+const (
+	RouterCloudflare = "cloudflare"
+	RouterSQLite     = "sqlite"
+	RouterMemory     = "memory"
+)
+
+type Route struct {
+	Host   string `json:"host"`
+	SiteID string `json:"siteId"`
+}
+
+type Router interface {
+	MapHost(host, siteID string) error
+	UnmapHost(host string) error
+	SetActiveDeployment(siteID, deployID string) error
+	ClearActiveDeployment(siteID string) error
+	LookupHost(host string) (string, error)
+	ActiveDeployment(siteID string) (string, error)
+	ListHosts() ([]Route, error)
+	MapPreview(host, siteID, deployID string) error
+	UnmapPreview(host string) error
+	LookupPreview(host string) (siteID, deployID string, err error)
+}
+
+func NewRouter(kind string, database *sql.DB, cf *CloudflareClient) (Router, error) {
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "", RouterCloudflare:
+		return &KVRouter{CF: cf}, nil
+	case RouterSQLite:
+		return &SQLiteRouter{DB: database}, nil
+	case RouterMemory:
+		return NewMemoryRouter(), nil
+	default:
+		return nil, fmt.Errorf("unknown routing backend %q", kind)
+	}
+}
+
+func parseSubdomain(hostname, rootDomain string) string {
+	if rootDomain == "" {
+		return ""
+	}
+	h := strings.ToLower(hostname)
+	root := strings.ToLower(rootDomain)
+	if h == root || !strings.HasSuffix(h, "."+root) {
+		return ""
+	}
+	sub := strings.TrimSuffix(h, "."+root)
+	if sub == "" || strings.Contains(sub, ".") {
+		return ""
+	}
+	return sub
+}
+
+func ResolveHost(r Router, hostname, rootDomain string) (siteID, deployID string, err error) {
+	hostname = strings.ToLower(hostname)
+	sub := parseSubdomain(hostname, rootDomain)
+
+	siteID, err = r.LookupHost(hostname)
+	if err != nil {
+		return "", "", err
+	}
+	if siteID == "" && sub != "" {
+		siteID, err = r.LookupHost(sub)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	if siteID == "" {
+		if strings.Contains(sub, previewSeparator) {
+			return r.LookupPreview(sub)
+		}
+		return "", "", nil
+	}
+
+	deployID, err = r.ActiveDeployment(siteID)
+	if err != nil {
+		return "", "", err
+	}
+	return siteID, deployID, nil
+}
+
+func (e *Engine) EnsureRouting(host, siteID, deployID string) error {
+	if host != "" {
+		if err := e.Router.MapHost(host, siteID); err != nil {
+			return err
+		}
+	}
+	if deployID != "" {
+		if err := e.Router.SetActiveDeployment(siteID, deployID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func siteRoutingKey(domain string) string {
+	rootDomain := os.Getenv("FSD_EDGE_ROOT_DOMAIN")
+	if rootDomain != "" && strings.HasSuffix(domain, "."+rootDomain) {
+		return strings.TrimSuffix(domain, "."+rootDomain)
+	}
+	if rootDomain != "" && domain == rootDomain {
+		return "@"
+	}
+	return domain
+}
+
+func customDomainHost(hostname string) string {
+	hostname = strings.ToLower(strings.TrimSpace(hostname))
+	hostname = strings.TrimPrefix(hostname, "http://")
+	return strings.TrimPrefix(hostname, "https://")
+}
+
+func (e *Engine) RemoveRouting(subdomain, siteID, domain string) error {
+	if domain != "" {
+		if err := e.Router.UnmapHost(domain); err != nil {
+			return err
+		}
+	}
+	if subdomain != "" {
+		if err := e.Router.UnmapHost(subdomain); err != nil {
+			return err
+		}
+	}
+	if siteID != "" {
+		if err := e.Router.ClearActiveDeployment(siteID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type KVRouter struct {
+	CF *CloudflareClient
+}
+
+func (r *KVRouter) MapHost(host, siteID string) error {
+	return r.CF.KVPut("host:"+host, siteID)
+}
+
+func (r *KVRouter) UnmapHost(host string) error {
+	return r.CF.KVDelete("host:" + host)
+}
+
+func (r *KVRouter) SetActiveDeployment(siteID, deployID string) error {
+	return r.CF.KVPut("current:"+siteID, deployID)
+}
+
+func (r *KVRouter) ClearActiveDeployment(siteID string) error {
+	return r.CF.KVDelete("current:" + siteID)
+}
+
+func (r *KVRouter) LookupHost(host string) (string, error) {
+	return r.CF.KVGet("host:" + host)
+}
+
+func (r *KVRouter) ActiveDeployment(siteID string) (string, error) {
+	return r.CF.KVGet("current:" + siteID)
+}
+
+func (r *KVRouter) ListHosts() ([]Route, error) {
+	keys, err := r.CF.KVListKeys("host:")
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []Route
+	for _, key := range keys {
+		siteID, err := r.CF.KVGet(key)
+		if err != nil {
+			return nil, err
+		}
+		if siteID == "" {
+			continue
+		}
+		routes = append(routes, Route{Host: strings.TrimPrefix(key, "host:"), SiteID: siteID})
+	}
+	return routes, nil
+}
+
+func (r *KVRouter) MapPreview(host, siteID, deployID string) error {
+	return r.CF.KVPut("preview:"+host, siteID+":"+deployID)
+}
+
+func (r *KVRouter) UnmapPreview(host string) error {
+	return r.CF.KVDelete("preview:" + host)
+}
+
+func (r *KVRouter) LookupPreview(host string) (string, string, error) {
+	value, err := r.CF.KVGet("preview:" + host)
+	if err != nil || value == "" {
+		return "", "", err
+	}
+	siteID, deployID, _ := strings.Cut(value, ":")
+	return siteID, deployID, nil
+}
+
+func (c *CloudflareClient) KVListKeys(prefix string) ([]string, error) {
+	var keys []string
+	cursor := ""
+
+	for {
+		path := fmt.Sprintf("/accounts/%s/storage/kv/namespaces/%s/keys?prefix=%s",
+			c.AccountID, c.NamespaceID, url.QueryEscape(prefix))
+		if cursor != "" {
+			path += "&cursor=" + url.QueryEscape(cursor)
+		}
+
+		resp, err := c.Do("GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var res struct {
+			Result []struct {
+				Name string `json:"name"`
+			} `json:"result"`
+			ResultInfo struct {
+				Cursor string `json:"cursor"`
+			} `json:"result_info"`
+			Success bool `json:"success"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if !res.Success {
+			return nil, fmt.Errorf("kv_list_keys failed: %s", resp.Status)
+		}
+
+		for _, k := range res.Result {
+			keys = append(keys, k.Name)
+		}
+
+		if res.ResultInfo.Cursor == "" {
+			break
+		}
+		cursor = res.ResultInfo.Cursor
+	}
+
+	return keys, nil
+}
+
+type SQLiteRouter struct {
+	DB *sql.DB
+}
+
+func (r *SQLiteRouter) MapHost(host, siteID string) error {
+	return db.UpsertRouteHost(r.DB, host, siteID)
+}
+
+func (r *SQLiteRouter) UnmapHost(host string) error {
+	return db.DeleteRouteHost(r.DB, host)
+}
+
+func (r *SQLiteRouter) SetActiveDeployment(siteID, deployID string) error {
+	return db.UpsertRouteDeployment(r.DB, siteID, deployID)
+}
+
+func (r *SQLiteRouter) ClearActiveDeployment(siteID string) error {
+	return db.DeleteRouteDeployment(r.DB, siteID)
+}
+
+func (r *SQLiteRouter) LookupHost(host string) (string, error) {
+	return db.GetRouteHost(r.DB, host)
+}
+
+func (r *SQLiteRouter) ActiveDeployment(siteID string) (string, error) {
+	return db.GetRouteDeployment(r.DB, siteID)
+}
+
+func (r *SQLiteRouter) ListHosts() ([]Route, error) {
+	hosts, err := db.ListRouteHosts(r.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make([]Route, 0, len(hosts))
+	for _, h := range hosts {
+		routes = append(routes, Route{Host: h.Host, SiteID: h.SiteID})
+	}
+	return routes, nil
+}
+
+func (r *SQLiteRouter) MapPreview(host, siteID, deployID string) error {
+	return db.UpsertRoutePreview(r.DB, host, siteID, deployID)
+}
+
+func (r *SQLiteRouter) UnmapPreview(host string) error {
+	return db.DeleteRoutePreview(r.DB, host)
+}
+
+func (r *SQLiteRouter) LookupPreview(host string) (string, string, error) {
+	return db.GetRoutePreview(r.DB, host)
+}
+
+type MemoryRouter struct {
+	mu       sync.RWMutex
+	hosts    map[string]string
+	current  map[string]string
+	previews map[string]previewRoute
+}
+
+type previewRoute struct {
+	siteID   string
+	deployID string
+}
+
+func NewMemoryRouter() *MemoryRouter {
+	return &MemoryRouter{
+		hosts:    make(map[string]string),
+		current:  make(map[string]string),
+		previews: make(map[string]previewRoute),
+	}
+}
+
+func (r *MemoryRouter) MapHost(host, siteID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hosts[host] = siteID
+	return nil
+}
+
+func (r *MemoryRouter) UnmapHost(host string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.hosts, host)
+	return nil
+}
+
+func (r *MemoryRouter) SetActiveDeployment(siteID, deployID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current[siteID] = deployID
+	return nil
+}
+
+func (r *MemoryRouter) ClearActiveDeployment(siteID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.current, siteID)
+	return nil
+}
+
+func (r *MemoryRouter) LookupHost(host string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.hosts[host], nil
+}
+
+func (r *MemoryRouter) ActiveDeployment(siteID string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current[siteID], nil
+}
+
+func (r *MemoryRouter) ListHosts() ([]Route, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	routes := make([]Route, 0, len(r.hosts))
+	for host, siteID := range r.hosts {
+		routes = append(routes, Route{Host: host, SiteID: siteID})
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Host < routes[j].Host })
+	return routes, nil
+}
+
+func (r *MemoryRouter) MapPreview(host, siteID, deployID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.previews[host] = previewRoute{siteID: siteID, deployID: deployID}
+	return nil
+}
+
+func (r *MemoryRouter) UnmapPreview(host string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.previews, host)
+	return nil
+}
+
+func (r *MemoryRouter) LookupPreview(host string) (string, string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p := r.previews[host]
+	return p.siteID, p.deployID, nil
+}
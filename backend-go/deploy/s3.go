@@ -0,0 +1,398 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s3UnsignedPayload  = "UNSIGNED-PAYLOAD"
+)
+
+type S3Client struct {
+	Endpoint  *url.URL
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+	Client    *http.Client
+}
+
+func NewS3Client(endpoint, region, bucket, accessKey, secretKey string, pathStyle bool) (*S3Client, error) {
+	u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3Client{
+		Endpoint:  u,
+		Region:    region,
+		Bucket:    bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		PathStyle: pathStyle,
+		Client:    &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+func uriEscape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func (c *S3Client) objectURL(key string, query url.Values) (*url.URL, string) {
+	u := *c.Endpoint
+	path := strings.TrimRight(u.Path, "/")
+	if c.PathStyle {
+		path += "/" + c.Bucket
+	} else {
+		u.Host = c.Bucket + "." + u.Host
+	}
+	if key != "" || !c.PathStyle {
+		path += "/" + key
+	}
+
+	u.Path = path
+	u.RawPath = uriEscape(path, true)
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var q []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			q = append(q, uriEscape(k, false)+"="+uriEscape(v, false))
+		}
+	}
+	u.RawQuery = strings.Join(q, "&")
+
+	return &u, u.RawPath
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func (c *S3Client) sign(req *http.Request, canonicalPath, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headerNames := []string{"host"}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-md5" || lower == "content-type" {
+			headerNames = append(headerNames, lower)
+		}
+	}
+	sort.Strings(headerNames)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		value := req.URL.Host
+		if name != "host" {
+			value = strings.TrimSpace(req.Header.Get(name))
+		}
+		canonicalHeaders.WriteString(name + ":" + value + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + c.Region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+c.SecretKey), day)
+	signingKey = hmacSHA256(signingKey, c.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKey, scope, signedHeaders, signature))
+}
+
+func (c *S3Client) do(method, key string, query url.Values, body io.Reader, size int64, header http.Header, payloadHash string) (*http.Response, error) {
+	u, canonicalPath := c.objectURL(key, query)
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.URL = u
+	if body != nil {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	c.sign(req, canonicalPath, payloadHash, time.Now())
+
+	return c.Client.Do(req)
+}
+
+func s3Error(op string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var res struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(body, &res) == nil && res.Code != "" {
+		return fmt.Errorf("%s failed: %d %s: %s", op, resp.StatusCode, res.Code, res.Message)
+	}
+	return fmt.Errorf("%s failed: %d", op, resp.StatusCode)
+}
+
+func (c *S3Client) Upload(key string, body io.Reader, size int64, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+
+	resp, err := c.do("PUT", key, nil, body, size, header, s3UnsignedPayload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return s3Error("put_object", resp)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (c *S3Client) List(prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	token := ""
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := c.do("GET", "", query, nil, 0, nil, s3EmptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != 200 {
+			err := s3Error("list_objects", resp)
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var res struct {
+			Contents []struct {
+				Key  string `xml:"Key"`
+				Size int64  `xml:"Size"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range res.Contents {
+			objects = append(objects, ObjectInfo{Key: obj.Key, Size: obj.Size})
+		}
+
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			break
+		}
+		token = res.NextContinuationToken
+	}
+
+	return objects, nil
+}
+
+func (c *S3Client) deleteObjects(keys []string) error {
+	type object struct {
+		Key string `xml:"Key"`
+	}
+	payload := struct {
+		XMLName xml.Name `xml:"Delete"`
+		Quiet   bool     `xml:"Quiet"`
+		Objects []object `xml:"Object"`
+	}{Quiet: true}
+	for _, k := range keys {
+		payload.Objects = append(payload.Objects, object{Key: k})
+	}
+
+	body, err := xml.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	sum := md5.Sum(body)
+	hash := sha256.Sum256(body)
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml")
+	header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+
+	query := url.Values{}
+	query.Set("delete", "")
+
+	resp, err := c.do("POST", "", query, bytes.NewReader(body), int64(len(body)), header, hex.EncodeToString(hash[:]))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return s3Error("delete_objects", resp)
+	}
+
+	var res struct {
+		Errors []struct {
+			Key     string `xml:"Key"`
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		} `xml:"Error"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&res); err == nil {
+		for _, e := range res.Errors {
+			fmt.Printf("Failed to delete %s: %s %s\n", e.Key, e.Code, e.Message)
+		}
+	}
+	return nil
+}
+
+func (c *S3Client) DeletePrefix(prefix string) error {
+	objects, err := c.List(prefix)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	return c.Delete(keys)
+}
+
+func (c *S3Client) Delete(keys []string) error {
+	const batchSize = 1000
+	for start := 0; start < len(keys); start += batchSize {
+		end := start + batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		if err := c.deleteObjects(keys[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *S3Client) Stat(key string) (*ObjectInfo, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do("HEAD", key, nil, nil, 0, nil, s3EmptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrObjectNotFound
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("head_object failed: %d", resp.StatusCode)
+	}
+
+	size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	return &ObjectInfo{
+		Key:         key,
+		Size:        size,
+		ContentType: resp.Header.Get("Content-Type"),
+	}, nil
+}
+
+func (c *S3Client) Open(key string) (io.ReadCloser, *ObjectInfo, error) {
+	if err := validateKey(key); err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := c.do("GET", key, nil, nil, 0, nil, s3EmptyPayloadHash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, nil, ErrObjectNotFound
+	}
+	if resp.StatusCode != 200 {
+		err := s3Error("get_object", resp)
+		resp.Body.Close()
+		return nil, nil, err
+	}
+
+	return resp.Body, &ObjectInfo{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+	}, nil
+}
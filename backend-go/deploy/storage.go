@@ -0,0 +1,256 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	StorageB2    = "b2"
+	StorageS3    = "s3"
+	StorageLocal = "local"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+type ObjectInfo struct {
+	Key             string
+	Size            int64
+	ContentType     string
+	ContentEncoding string
+}
+
+type Storage interface {
+	Upload(key string, body io.Reader, size int64, contentType string) error
+	List(prefix string) ([]ObjectInfo, error)
+	DeletePrefix(prefix string) error
+	Delete(keys []string) error
+	Stat(key string) (*ObjectInfo, error)
+	Open(key string) (io.ReadCloser, *ObjectInfo, error)
+}
+
+type StorageConfig struct {
+	Backend string
+
+	B2KeyID      string
+	B2AppKey     string
+	B2BucketID   string
+	B2BucketName string
+
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool
+
+	LocalDir string
+}
+
+func NewStorage(cfg StorageConfig) (Storage, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.Backend)) {
+	case "", StorageB2:
+		b2 := NewB2Client(cfg.B2KeyID, cfg.B2AppKey, cfg.B2BucketID)
+		b2.BucketName = cfg.B2BucketName
+		return b2, nil
+	case StorageS3:
+		if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+			return nil, fmt.Errorf("s3 storage requires S3_ENDPOINT and S3_BUCKET")
+		}
+		return NewS3Client(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3PathStyle)
+	case StorageLocal:
+		if cfg.LocalDir == "" {
+			return nil, fmt.Errorf("local storage requires STORAGE_LOCAL_DIR")
+		}
+		return NewLocalStorage(cfg.LocalDir)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." || part == "." {
+			return fmt.Errorf("invalid storage key %q", key)
+		}
+	}
+	return nil
+}
+
+type LocalStorage struct {
+	Root string
+}
+
+func NewLocalStorage(root string) (*LocalStorage, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalStorage{Root: abs}, nil
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStorage) Upload(key string, body io.Reader, size int64, contentType string) error {
+	dest, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && n != size {
+		return fmt.Errorf("short upload for %s: wrote %d of %d bytes", key, n, size)
+	}
+
+	return os.Rename(tmp.Name(), dest)
+}
+
+func (s *LocalStorage) List(prefix string) ([]ObjectInfo, error) {
+	dir := s.Root
+	if i := strings.LastIndex(prefix, "/"); i > 0 {
+		d, err := s.path(prefix[:i])
+		if err != nil {
+			return nil, err
+		}
+		dir = d
+	}
+
+	var objects []ObjectInfo
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		objects = append(objects, ObjectInfo{
+			Key:         key,
+			Size:        info.Size(),
+			ContentType: mime.TypeByExtension(filepath.Ext(key)),
+		})
+		return nil
+	})
+	return objects, err
+}
+
+func (s *LocalStorage) DeletePrefix(prefix string) error {
+	if strings.HasSuffix(prefix, "/") {
+		dir, err := s.path(strings.TrimSuffix(prefix, "/"))
+		if err != nil {
+			return err
+		}
+		return os.RemoveAll(dir)
+	}
+
+	objects, err := s.List(prefix)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		p, err := s.path(obj.Key)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *LocalStorage) Delete(keys []string) error {
+	for _, key := range keys {
+		p, err := s.path(key)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *LocalStorage) Stat(key string) (*ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, ErrObjectNotFound
+	}
+	return &ObjectInfo{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(filepath.Ext(key)),
+	}, nil
+}
+
+func (s *LocalStorage) Open(key string) (io.ReadCloser, *ObjectInfo, error) {
+	info, err := s.Stat(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, _ := s.path(key)
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, ErrObjectNotFound
+		}
+		return nil, nil, err
+	}
+	return f, info, nil
+}
@@ -0,0 +1,313 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nrednav/cuid2"
+
+	"boop-cat/db"
+	"boop-cat/lib"
+)
+
+const (
+	EventDeploymentCreated   = "deployment.created"
+	EventDeploymentBuilding  = "deployment.building"
+	EventDeploymentSucceeded = "deployment.succeeded"
+	EventDeploymentFailed    = "deployment.failed"
+	EventDeploymentCanceled  = "deployment.canceled"
+	EventDomainActivated     = "domain.activated"
+
+	maxWebhookAttempts     = 8
+	webhookBaseBackoff     = 30 * time.Second
+	webhookTimeout         = 10 * time.Second
+	webhookLease           = 2 * time.Minute
+	webhookBatchSize       = 20
+	webhookPollInterval    = 5 * time.Second
+	webhookDeliveryMaxAge  = 30 * 24 * time.Hour
+	maxWebhookResponseBody = 1 << 10
+)
+
+var WebhookEvents = []string{
+	EventDeploymentCreated,
+	EventDeploymentBuilding,
+	EventDeploymentSucceeded,
+	EventDeploymentFailed,
+	EventDeploymentCanceled,
+	EventDomainActivated,
+}
+
+var (
+	errPrivateAddress          = errors.New("webhook target resolves to a private address")
+	ErrWebhookEndpointDisabled = errors.New("webhook endpoint is disabled")
+)
+
+var nonPublicNetworks = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+		"172.16.0.0/12", "192.0.0.0/24", "192.0.2.0/24", "192.88.99.0/24", "192.168.0.0/16",
+		"198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24", "224.0.0.0/4", "240.0.0.0/4",
+		"::/128", "::1/128", "64:ff9b::/96", "64:ff9b:1::/48", "100::/64", "2001::/32",
+		"2001:db8::/32", "2002::/16", "fc00::/7", "fe80::/10", "ff00::/8",
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+func publicIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, n := range nonPublicNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: webhookTimeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if !publicIP(net.ParseIP(host)) {
+					return errPrivateAddress
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+type webhookSite struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type webhookEvent struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	CreatedAt string                 `json:"createdAt"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+func SignWebhookPayload(payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (e *Engine) emitDeploymentEvent(deployID, event string) {
+	d, err := db.GetDeploymentByID(e.DB, deployID)
+	if err != nil {
+		return
+	}
+	site, err := db.GetSiteByIDAdmin(e.DB, d.SiteID)
+	if err != nil {
+		return
+	}
+	e.emit(site, event, map[string]interface{}{
+		"deployment": d.ToResponse(),
+	})
+}
+
+func (e *Engine) EmitDomainActivated(siteID, hostname string) {
+	site, err := db.GetSiteByIDAdmin(e.DB, siteID)
+	if err != nil {
+		return
+	}
+	e.emit(site, EventDomainActivated, map[string]interface{}{
+		"domain": map[string]string{"hostname": hostname},
+	})
+}
+
+func (e *Engine) emit(site *db.Site, event string, data map[string]interface{}) {
+	endpoints, err := db.ListWebhookEndpointsForSite(e.DB, site.UserID, site.ID)
+	if err != nil {
+		log.Printf("[Webhooks] Failed to list endpoints for site %s: %v", site.ID, err)
+		return
+	}
+
+	data["site"] = webhookSite{ID: site.ID, Name: site.Name}
+	payload, err := json.Marshal(webhookEvent{
+		ID:        cuid2.Generate(),
+		Type:      event,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Data:      data,
+	})
+	if err != nil {
+		return
+	}
+
+	queued := 0
+	for _, endpoint := range endpoints {
+		if !endpoint.Subscribed(event) {
+			continue
+		}
+		if err := db.CreateWebhookDelivery(e.DB, cuid2.Generate(), endpoint.ID, event, string(payload), ""); err != nil {
+			log.Printf("[Webhooks] Failed to queue %s for endpoint %s: %v", event, endpoint.ID, err)
+			continue
+		}
+		queued++
+	}
+	if queued > 0 {
+		e.wakeWebhooks()
+	}
+}
+
+func (e *Engine) ReplayWebhookDelivery(delivery *db.WebhookDelivery) (string, error) {
+	endpoint, err := db.GetWebhookEndpointByID(e.DB, delivery.EndpointID)
+	if err != nil {
+		return "", err
+	}
+	if !endpoint.Enabled {
+		return "", ErrWebhookEndpointDisabled
+	}
+
+	id := cuid2.Generate()
+	if err := db.CreateWebhookDelivery(e.DB, id, delivery.EndpointID, delivery.Event, delivery.Payload, delivery.ID); err != nil {
+		return "", err
+	}
+	e.wakeWebhooks()
+	return id, nil
+}
+
+func (e *Engine) wakeWebhooks() {
+	select {
+	case e.webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+func (e *Engine) webhookWorker() {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+
+	for {
+		if time.Since(lastPrune) > time.Hour {
+			if n, err := db.PruneWebhookDeliveries(e.DB, webhookDeliveryMaxAge); err != nil {
+				log.Printf("[Webhooks] Failed to prune delivery log: %v", err)
+			} else if n > 0 {
+				log.Printf("[Webhooks] Pruned %d old deliveries", n)
+			}
+			lastPrune = time.Now()
+		}
+
+		deliveries, err := db.ClaimDueWebhookDeliveries(e.DB, webhookLease, webhookBatchSize)
+		if err != nil {
+			log.Printf("[Webhooks] Failed to claim deliveries: %v", err)
+		}
+
+		var wg sync.WaitGroup
+		for _, d := range deliveries {
+			wg.Add(1)
+			go func(d db.WebhookDelivery) {
+				defer wg.Done()
+				e.deliverWebhook(d)
+			}(d)
+		}
+		wg.Wait()
+
+		if len(deliveries) == webhookBatchSize {
+			continue
+		}
+		select {
+		case <-e.webhookWake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func webhookBackoff(attempt int) time.Duration {
+	return webhookBaseBackoff * time.Duration(1<<uint(attempt-1))
+}
+
+func (e *Engine) deliverWebhook(d db.WebhookDelivery) {
+	endpoint, err := db.GetWebhookEndpointByID(e.DB, d.EndpointID)
+	if err != nil {
+		return
+	}
+
+	if !endpoint.Enabled {
+		db.FinishWebhookDeliveryAttempt(e.DB, d.ID, db.DeliveryFailed, 0, ErrWebhookEndpointDisabled.Error(), nil)
+		return
+	}
+
+	code, err := postWebhook(endpoint, d)
+	attempt := d.Attempts + 1
+	if err == nil {
+		db.FinishWebhookDeliveryAttempt(e.DB, d.ID, db.DeliveryDelivered, code, "", nil)
+		return
+	}
+
+	if attempt >= maxWebhookAttempts || errors.Is(err, errPrivateAddress) {
+		log.Printf("[Webhooks] Giving up on delivery %s to %s after %d attempts: %v", d.ID, endpoint.URL, attempt, err)
+		db.FinishWebhookDeliveryAttempt(e.DB, d.ID, db.DeliveryFailed, code, err.Error(), nil)
+		return
+	}
+
+	next := time.Now().Add(webhookBackoff(attempt))
+	db.FinishWebhookDeliveryAttempt(e.DB, d.ID, db.DeliveryPending, code, err.Error(), &next)
+}
+
+func postWebhook(endpoint *db.WebhookEndpoint, d db.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "boop.cat-webhooks")
+	req.Header.Set("X-Boop-Event", d.Event)
+	req.Header.Set("X-Boop-Delivery", d.ID)
+	req.Header.Set("X-Boop-Signature-256", SignWebhookPayload(body, lib.Decrypt(endpoint.Secret)))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxWebhookResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package deploy
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		secret  string
+		want    string
+	}{
+		// RFC 4231 test case 2.
+		{"rfc 4231", "what do ya want for nothing?", "Jefe",
+			"sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+		{"empty payload", "", "key",
+			"sha256=5d5d139563c95b5967b9bd9a8c9b233a9dedb45072794cd232dc1b74832607d0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SignWebhookPayload([]byte(tt.payload), tt.secret); got != tt.want {
+				t.Errorf("SignWebhookPayload() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"198.18.0.1", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::1", false},
+		{"::", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"fc00::1", false},
+		{"fe80::1", false},
+		{"64:ff9b::a00:1", false},
+		{"2001:db8::1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := publicIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("publicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+	if publicIP(nil) {
+		t.Error("publicIP(nil) = true, want false")
+	}
+}
@@ -3,6 +3,7 @@ module boop-cat
 go 1.23.0
 
 require (
+	github.com/andybalholm/brotli v1.1.1
 	github.com/emersion/go-imap v1.2.1
 	github.com/emersion/go-message v0.18.2
 	github.com/go-chi/chi/v5 v5.2.2
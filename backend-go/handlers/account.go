@@ -32,6 +32,8 @@ func (h *AccountHandler) Routes() chi.Router {
 	r.Delete("/linked-accounts/{id}", h.UnlinkAccount)
 	r.Post("/email", h.ChangeEmail)
 	r.Post("/password", h.ChangePassword)
+	r.Get("/notifications", h.GetNotificationSettings)
+	r.Put("/notifications", h.UpdateNotificationSettings)
 
 	return r
 }
@@ -9,17 +9,20 @@ import (
 	"encoding/json"
 	"net/http"
 	"os"
+	"strconv"
 
 	"boop-cat/db"
+	"boop-cat/deploy"
 	"github.com/go-chi/chi/v5"
 )
 
 type AdminHandler struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Engine *deploy.Engine
 }
 
-func NewAdminHandler(database *sql.DB) *AdminHandler {
-	return &AdminHandler{DB: database}
+func NewAdminHandler(database *sql.DB, engine *deploy.Engine) *AdminHandler {
+	return &AdminHandler{DB: database, Engine: engine}
 }
 
 func (h *AdminHandler) RequireAdminKey(next http.Handler) http.Handler {
@@ -41,6 +44,7 @@ func (h *AdminHandler) Routes() chi.Router {
 	r.Post("/ban", h.BanUser)
 	r.Get("/lookup", h.LookupDomain)
 	r.Get("/sites", h.ListSites)
+	r.Get("/retention", h.RetentionReport)
 
 	return r
 }
@@ -180,3 +184,24 @@ func (h *AdminHandler) PollDMCA(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"ok":true,"message":"Polling initiated (stub)."}`))
 }
+
+func (h *AdminHandler) RetentionReport(w http.ResponseWriter, r *http.Request) {
+	keep := h.Engine.RetentionKeep
+	if v := r.URL.Query().Get("keep"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			jsonError(w, "invalid-params", http.StatusBadRequest)
+			return
+		}
+		keep = n
+	}
+
+	report, err := h.Engine.RunRetention(keep, true)
+	if err != nil {
+		jsonError(w, "retention-failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
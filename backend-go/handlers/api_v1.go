@@ -34,6 +34,8 @@ func (h *APIV1Handler) Routes() chi.Router {
 	r.Get("/sites/{id}", h.GetSite)
 	r.Post("/sites/{id}/deploy", h.TriggerDeploy)
 	r.Get("/sites/{id}/deployments", h.ListDeployments)
+	r.Post("/sites/{id}/deployments/{deploymentId}/promote", h.PromoteDeployment)
+	r.Post("/sites/{id}/rollback", h.RollbackSite)
 
 	return r
 }
@@ -138,9 +140,12 @@ func (h *APIV1Handler) ListDeployments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	positions := h.Engine.QueuePositions()
 	var resp []db.DeploymentResponse
 	for _, d := range deps {
-		resp = append(resp, d.ToResponse())
+		r := d.ToResponse()
+		r.SetQueuePosition(positions)
+		resp = append(resp, r)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
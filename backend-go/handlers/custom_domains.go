@@ -151,7 +151,8 @@ func (h *CustomDomainHandler) CreateCustomDomain(w http.ResponseWriter, r *http.
 	}
 
 	if combined == "active" {
-		cf.EnsureRouting(hostname, siteID, "")
+		h.Engine.EnsureRouting(hostname, siteID, "")
+		h.Engine.EmitDomainActivated(siteID, hostname)
 	}
 
 	d, _ := db.GetCustomDomainByID(h.DB, id)
@@ -205,7 +206,8 @@ func (h *CustomDomainHandler) PollCustomDomain(w http.ResponseWriter, r *http.Re
 	db.UpdateCustomDomainStatus(h.DB, id, combined, sslStatus, string(recordsJSON), cfRes.ID)
 
 	if combined == "active" && domain.Status != "active" {
-		cf.EnsureRouting(domain.Hostname, siteID, "")
+		h.Engine.EnsureRouting(domain.Hostname, siteID, "")
+		h.Engine.EmitDomainActivated(siteID, domain.Hostname)
 	}
 
 	updated, _ := db.GetCustomDomainByID(h.DB, id)
@@ -321,7 +323,7 @@ func (h *CustomDomainHandler) DeleteCustomDomain(w http.ResponseWriter, r *http.
 		}
 	}
 
-	cf.RemoveRouting("", "", domain.Hostname)
+	h.Engine.RemoveRouting("", "", domain.Hostname)
 
 	db.DeleteCustomDomain(h.DB, id)
 
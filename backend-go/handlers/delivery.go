@@ -0,0 +1,269 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"boop-cat/deploy"
+)
+
+var (
+	assetExtensions = regexp.MustCompile(`(?i)\.(js|mjs|css|png|jpg|jpeg|webp|avif|svg|gif|ico|woff|woff2|ttf|otf|eot|map|json|xml|txt|pdf|mp4|webm|mp3|wav)$`)
+	hashedAsset     = regexp.MustCompile(`(?i)\.[a-f0-9]{8,}\.(js|css)$`)
+)
+
+const maxCachedManifests = 512
+
+type DeliveryHandler struct {
+	Engine     *deploy.Engine
+	RootDomain string
+	AppHost    string
+	TrustProxy bool
+
+	mu        sync.Mutex
+	manifests map[string]*deploy.Manifest
+}
+
+func NewDeliveryHandler(engine *deploy.Engine, rootDomain, publicURL string, trustProxy bool) *DeliveryHandler {
+	appHost := ""
+	if u, err := url.Parse(strings.TrimSpace(publicURL)); err == nil {
+		appHost = strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	}
+	return &DeliveryHandler{
+		Engine:     engine,
+		RootDomain: strings.ToLower(rootDomain),
+		AppHost:    appHost,
+		TrustProxy: trustProxy,
+		manifests:  make(map[string]*deploy.Manifest),
+	}
+}
+
+func isAssetPath(pathname string) bool {
+	return strings.HasPrefix(pathname, "/assets/") || assetExtensions.MatchString(pathname)
+}
+
+func getCacheControl(pathname string) string {
+	if pathname == "/" || strings.HasSuffix(pathname, ".html") {
+		return "public, max-age=60, s-maxage=60"
+	}
+	if strings.HasPrefix(pathname, "/assets/") || hashedAsset.MatchString(pathname) {
+		return "public, max-age=31536000, immutable"
+	}
+	if assetExtensions.MatchString(pathname) {
+		return "public, max-age=86400, s-maxage=604800"
+	}
+	return "public, max-age=300, s-maxage=3600"
+}
+
+func stripFirstSegment(pathname string) string {
+	var parts []string
+	for _, p := range strings.Split(pathname, "/") {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) > 1 {
+		return "/" + strings.Join(parts[1:], "/")
+	}
+	return pathname
+}
+
+func (h *DeliveryHandler) hostname(r *http.Request) string {
+	host := r.Host
+	if h.TrustProxy {
+		if fwd := r.Header.Get("X-Forwarded-Host"); fwd != "" {
+			host = strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+	}
+	if hp, _, err := net.SplitHostPort(host); err == nil {
+		host = hp
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+func (h *DeliveryHandler) isAppHost(host string) bool {
+	if host == "" || host == h.RootDomain || host == h.AppHost || host == "localhost" {
+		return true
+	}
+	return net.ParseIP(strings.Trim(host, "[]")) != nil
+}
+
+func (h *DeliveryHandler) Wrap(app http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.isAppHost(h.hostname(r)) {
+			app.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (h *DeliveryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	siteID, deployID, err := deploy.ResolveHost(h.Engine.Router, h.hostname(r), h.RootDomain)
+	if err != nil {
+		fmt.Printf("Warning: routing lookup failed for %s: %v\n", r.Host, err)
+		http.Error(w, "Routing unavailable", http.StatusBadGateway)
+		return
+	}
+	if siteID == "" {
+		http.Error(w, "Site not found", http.StatusNotFound)
+		return
+	}
+	if deployID == "" {
+		http.Error(w, "No deployment found", http.StatusNotFound)
+		return
+	}
+
+	pathname := r.URL.Path
+	if pathname == "" {
+		pathname = "/"
+	}
+	cleaned := path.Clean(pathname)
+	if strings.HasSuffix(pathname, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	pathname = cleaned
+
+	keyPath := strings.TrimPrefix(pathname, "/")
+	if keyPath == "" {
+		keyPath = "index.html"
+	}
+	manifest, err := h.manifest(siteID, deployID)
+	if err != nil {
+		fmt.Printf("Warning: manifest read failed for %s: %v\n", deployID, err)
+		http.Error(w, "Storage unavailable", http.StatusBadGateway)
+		return
+	}
+	acceptEncoding := r.Header.Get("Accept-Encoding")
+	open := func(keyPath string) (io.ReadCloser, *deploy.ObjectInfo, error) {
+		return h.openPath(siteID, deployID, manifest, keyPath, acceptEncoding)
+	}
+
+	body, info, err := open(keyPath)
+
+	if errors.Is(err, deploy.ErrObjectNotFound) && isAssetPath(pathname) {
+		if rewritten := stripFirstSegment(pathname); rewritten != pathname {
+			body, info, err = open(strings.TrimPrefix(rewritten, "/"))
+		}
+	}
+
+	if errors.Is(err, deploy.ErrObjectNotFound) && !isAssetPath(pathname) {
+		dirKey := strings.TrimSuffix(keyPath, "/") + "/index.html"
+		if dirBody, dirInfo, dirErr := open(dirKey); dirErr == nil {
+			body, info, err = dirBody, dirInfo, nil
+		}
+	}
+
+	if errors.Is(err, deploy.ErrObjectNotFound) && !isAssetPath(pathname) {
+		body, info, err = open("index.html")
+	}
+
+	if errors.Is(err, deploy.ErrObjectNotFound) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Warning: storage read failed for %s/%s: %v\n", siteID, deployID, err)
+		http.Error(w, "Storage unavailable", http.StatusBadGateway)
+		return
+	}
+	defer body.Close()
+
+	contentType := info.ContentType
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = deploy.ContentTypeFor(info.Key)
+	}
+
+	headers := w.Header()
+	headers.Set("Content-Type", contentType)
+	if info.Size >= 0 {
+		headers.Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	if info.ContentEncoding != "" {
+		headers.Set("Content-Encoding", info.ContentEncoding)
+	}
+	if manifest != nil {
+		headers.Set("Vary", "Accept-Encoding")
+	}
+	headers.Set("Cache-Control", getCacheControl(pathname))
+	headers.Set("X-Content-Type-Options", "nosniff")
+
+	headers.Set("Server", "boop.cat")
+	headers.Set("X-Boop-Host", "boop.cat")
+	headers.Set("X-Boop-Site-Id", siteID)
+	headers.Set("X-Boop-Deploy-Id", deployID)
+
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	io.Copy(w, body)
+}
+
+func (h *DeliveryHandler) manifest(siteID, deployID string) (*deploy.Manifest, error) {
+	h.mu.Lock()
+	m, ok := h.manifests[deployID]
+	h.mu.Unlock()
+	if ok {
+		return m, nil
+	}
+
+	m, err := deploy.LoadManifest(h.Engine.Storage, siteID, deployID)
+	if errors.Is(err, deploy.ErrObjectNotFound) {
+		m, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	if len(h.manifests) >= maxCachedManifests {
+		h.manifests = make(map[string]*deploy.Manifest)
+	}
+	h.manifests[deployID] = m
+	h.mu.Unlock()
+	return m, nil
+}
+
+func (h *DeliveryHandler) openPath(siteID, deployID string, m *deploy.Manifest, keyPath, acceptEncoding string) (io.ReadCloser, *deploy.ObjectInfo, error) {
+	if m == nil {
+		return h.Engine.Storage.Open(fmt.Sprintf("sites/%s/%s/%s", siteID, deployID, keyPath))
+	}
+
+	entry, ok := m.Files[keyPath]
+	if !ok {
+		return nil, nil, deploy.ErrObjectNotFound
+	}
+	info := &deploy.ObjectInfo{Key: keyPath, Size: entry.Size, ContentType: entry.ContentType}
+	hash := entry.Hash
+	if encoding, variant, ok := entry.Negotiate(acceptEncoding); ok {
+		hash = variant.Hash
+		info.Size = variant.Size
+		info.ContentEncoding = encoding
+	}
+
+	body, _, err := h.Engine.Storage.Open(deploy.BlobKey(siteID, hash))
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, info, nil
+}
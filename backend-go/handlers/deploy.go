@@ -8,10 +8,11 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
-	"os"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"boop-cat/config"
 	"boop-cat/db"
 	"boop-cat/deploy"
 	"boop-cat/middleware"
@@ -22,17 +23,24 @@ type DeployHandler struct {
 	Engine *deploy.Engine
 }
 
-func NewDeployHandler(database *sql.DB) *DeployHandler {
+func NewDeployHandler(database *sql.DB, cfg *config.Config) *DeployHandler {
 
 	engine := deploy.NewEngine(
 		database,
-		os.Getenv("B2_KEY_ID"),
-		os.Getenv("B2_APP_KEY"),
-		os.Getenv("B2_BUCKET_ID"),
-		os.Getenv("CF_API_TOKEN"),
-		os.Getenv("CF_ACCOUNT_ID"),
-		os.Getenv("CF_KV_NAMESPACE_ID"),
+		cfg.B2KeyID,
+		cfg.B2AppKey,
+		cfg.B2BucketID,
+		cfg.CFAPIToken,
+		cfg.CFAccountID,
+		cfg.CFKVNSID,
 	)
+	engine.MaxConcurrent = cfg.BuildMaxConcurrent
+	engine.MaxPerUser = cfg.BuildMaxPerUser
+	engine.BuildTimeout = time.Duration(cfg.BuildTimeoutSeconds) * time.Second
+	engine.MaxOutputBytes = int64(cfg.BuildMaxOutputBytes)
+	engine.RetentionKeep = cfg.RetentionKeepDeployments
+	engine.RetentionInterval = time.Duration(cfg.RetentionIntervalMinutes) * time.Minute
+	engine.NotifyThrottle = time.Duration(cfg.NotifyThrottleMinutes) * time.Minute
 	return &DeployHandler{DB: database, Engine: engine}
 }
 
@@ -83,9 +91,12 @@ func (h *DeployHandler) ListDeployments(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	positions := h.Engine.QueuePositions()
 	var resp []db.DeploymentResponse
 	for _, d := range deployments {
-		resp = append(resp, d.ToResponse())
+		r := d.ToResponse()
+		r.SetQueuePosition(positions)
+		resp = append(resp, r)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -107,8 +118,69 @@ func (h *DeployHandler) GetDeployment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	resp := d.ToResponse()
+	resp.SetQueuePosition(h.Engine.QueuePositions())
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(d.ToResponse())
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *DeployHandler) GetDeploymentFiles(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	deployID := chi.URLParam(r, "id")
+
+	d, err := db.GetDeploymentByID(h.DB, deployID)
+	if err != nil {
+		jsonError(w, "not-found", http.StatusNotFound)
+		return
+	}
+
+	if d.UserID != userID {
+		jsonError(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	files, err := db.ListDeploymentFiles(h.DB, deployID)
+	if err != nil {
+		jsonError(w, "files-failed", http.StatusInternalServerError)
+		return
+	}
+
+	if len(files) == 0 && d.SiteID != "" {
+		manifest, err := deploy.LoadManifest(h.Engine.Storage, d.SiteID, deployID)
+		if err == nil {
+			files, _ = manifest.Records()
+		}
+	}
+
+	type fileResponse struct {
+		Path        string                            `json:"path"`
+		Size        int64                             `json:"size"`
+		Hash        string                            `json:"hash"`
+		ContentType string                            `json:"contentType"`
+		Encodings   map[string]deploy.ManifestVariant `json:"encodings,omitempty"`
+	}
+
+	var totalSize int64
+	out := make([]fileResponse, 0, len(files))
+	for _, f := range files {
+		totalSize += f.Size
+		out = append(out, fileResponse{
+			Path:        f.Path,
+			Size:        f.Size,
+			Hash:        f.Hash,
+			ContentType: f.ContentType,
+			Encodings:   deploy.ParseEncodings(f.Encodings),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deploymentId": deployID,
+		"files":        out,
+		"totalFiles":   len(out),
+		"totalSize":    totalSize,
+	})
 }
 
 func (h *DeployHandler) toResponse(d *db.Deployment) map[string]interface{} {
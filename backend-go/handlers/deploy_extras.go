@@ -32,22 +32,28 @@ func (h *DeployHandler) GetDeploymentLogs(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if !d.LogsPath.Valid || d.LogsPath.String == "" {
-		w.Header().Set("Content-Type", "text/plain")
-		w.Write([]byte(""))
-		return
+	records := []deploy.LogRecord{}
+	if d.LogsPath.Valid && d.LogsPath.String != "" {
+		deploy.ReadLogRecords(d.LogsPath.String, 0, func(rec deploy.LogRecord) error {
+			records = append(records, rec)
+			return nil
+		})
 	}
 
-	content, err := os.ReadFile(d.LogsPath.String)
-	if err != nil {
-
-		w.Header().Set("Content-Type", "text/plain")
-		w.Write([]byte(""))
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":      d.ID,
+			"status":  d.Status,
+			"records": records,
+		})
 		return
 	}
 
 	w.Header().Set("Content-Type", "text/plain")
-	w.Write(content)
+	for _, rec := range records {
+		w.Write([]byte(rec.String() + "\n"))
+	}
 }
 
 func (h *AuthHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
@@ -95,11 +101,19 @@ func (h *DeployHandler) StopDeployment(w http.ResponseWriter, r *http.Request) {
 
 		if errDb == nil && (dCheck.Status == "running" || dCheck.Status == "active") {
 
-			cf := deploy.NewCloudflareClient(
-				os.Getenv("CF_ACCOUNT_ID"),
-				os.Getenv("CF_KV_NAMESPACE_ID"),
-				os.Getenv("CF_API_TOKEN"),
-			)
+			if dCheck.PreviewID.Valid {
+				preview, err := db.GetSitePreview(h.DB, dCheck.PreviewID.String)
+				if err == nil && preview.DeploymentID != nil && *preview.DeploymentID == deployID {
+					if err := h.Engine.Router.UnmapPreview(preview.Host); err != nil {
+						jsonError(w, "routing-update-failed", http.StatusInternalServerError)
+						return
+					}
+				}
+				db.UpdateDeploymentStatus(h.DB, deployID, "stopped", "")
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"ok":true}`))
+				return
+			}
 
 			site, _ := db.GetSiteByID(h.DB, userID, dCheck.SiteID)
 			if site != nil {
@@ -110,12 +124,12 @@ func (h *DeployHandler) StopDeployment(w http.ResponseWriter, r *http.Request) {
 					routingKey = strings.TrimSuffix(site.Domain, "."+rootDomain)
 				}
 
-				cf.RemoveRouting(routingKey, site.ID, site.Domain)
+				h.Engine.RemoveRouting(routingKey, site.ID, site.Domain)
 
 				customDomains, _ := db.ListCustomDomains(h.DB, site.ID)
 				for _, cd := range customDomains {
 
-					cf.RemoveRouting("", site.ID, cd.Hostname)
+					h.Engine.RemoveRouting("", site.ID, cd.Hostname)
 				}
 			}
 
@@ -127,6 +141,7 @@ func (h *DeployHandler) StopDeployment(w http.ResponseWriter, r *http.Request) {
 
 		if errDb == nil && dCheck.Status == "building" {
 			db.UpdateDeploymentStatus(h.DB, deployID, "canceled", "")
+			db.FinishDeploymentJob(h.DB, deployID, db.JobCanceled, "")
 			w.Header().Set("Content-Type", "application/json")
 			w.Write([]byte(`{"ok":true}`))
 			return
@@ -0,0 +1,284 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nrednav/cuid2"
+
+	"boop-cat/config"
+	"boop-cat/db"
+	"boop-cat/deploy"
+	"boop-cat/middleware"
+)
+
+const maxDeployHooksPerSite = 20
+
+type DeployHooksHandler struct {
+	DB         *sql.DB
+	Engine     *deploy.Engine
+	Limiter    *middleware.KeyedLimiter
+	TrustProxy bool
+}
+
+func NewDeployHooksHandler(database *sql.DB, engine *deploy.Engine, cfg *config.Config) *DeployHooksHandler {
+	window := time.Duration(cfg.RateDeployHookWindowMs) * time.Millisecond
+	return &DeployHooksHandler{
+		DB:         database,
+		Engine:     engine,
+		Limiter:    middleware.NewKeyedLimiter(cfg.RateDeployHookMax, window),
+		TrustProxy: cfg.TrustProxy,
+	}
+}
+
+func (h *DeployHooksHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Post("/{token}", h.Trigger)
+	return r
+}
+
+func (h *DeployHooksHandler) ownedSite(w http.ResponseWriter, r *http.Request) (*db.Site, bool) {
+	userID := middleware.GetUserID(r.Context())
+	site, err := db.GetSiteByID(h.DB, userID, chi.URLParam(r, "siteId"))
+	if err != nil || site == nil {
+		jsonError(w, "site-not-found", http.StatusNotFound)
+		return nil, false
+	}
+	return site, true
+}
+
+func (h *DeployHooksHandler) ListHooks(w http.ResponseWriter, r *http.Request) {
+	site, ok := h.ownedSite(w, r)
+	if !ok {
+		return
+	}
+
+	hooks, err := db.ListDeployHooks(h.DB, site.ID)
+	if err != nil {
+		jsonError(w, "list-hooks-failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"hooks": hooks,
+	})
+}
+
+func (h *DeployHooksHandler) CreateHook(w http.ResponseWriter, r *http.Request) {
+	site, ok := h.ownedSite(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid-json", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		jsonError(w, "name-required", http.StatusBadRequest)
+		return
+	}
+
+	hooks, err := db.ListDeployHooks(h.DB, site.ID)
+	if err != nil {
+		jsonError(w, "create-hook-failed", http.StatusInternalServerError)
+		return
+	}
+	if len(hooks) >= maxDeployHooksPerSite {
+		jsonError(w, "too-many-hooks", http.StatusBadRequest)
+		return
+	}
+
+	id := cuid2.Generate()
+	token := "dh_" + generateToken()
+	if err := db.CreateDeployHook(h.DB, id, site.ID, site.UserID, req.Name, token); err != nil {
+		jsonError(w, "create-hook-failed", http.StatusInternalServerError)
+		return
+	}
+
+	hook, err := db.GetDeployHook(h.DB, site.ID, id)
+	if err != nil {
+		jsonError(w, "create-hook-failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"hook":  hook,
+		"token": token,
+		"url":   fmt.Sprintf("/api/deploy-hooks/%s", token),
+	})
+}
+
+func (h *DeployHooksHandler) RenameHook(w http.ResponseWriter, r *http.Request) {
+	site, ok := h.ownedSite(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid-json", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		jsonError(w, "name-required", http.StatusBadRequest)
+		return
+	}
+
+	hookID := chi.URLParam(r, "hookId")
+	err := db.RenameDeployHook(h.DB, site.ID, hookID, req.Name)
+	if err == sql.ErrNoRows {
+		jsonError(w, "hook-not-found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		jsonError(w, "update-failed", http.StatusInternalServerError)
+		return
+	}
+
+	hook, _ := db.GetDeployHook(h.DB, site.ID, hookID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+func (h *DeployHooksHandler) DeleteHook(w http.ResponseWriter, r *http.Request) {
+	site, ok := h.ownedSite(w, r)
+	if !ok {
+		return
+	}
+
+	err := db.DeleteDeployHook(h.DB, site.ID, chi.URLParam(r, "hookId"))
+	if err == sql.ErrNoRows {
+		jsonError(w, "hook-not-found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		jsonError(w, "delete-failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
+
+func (h *DeployHooksHandler) ListTriggers(w http.ResponseWriter, r *http.Request) {
+	site, ok := h.ownedSite(w, r)
+	if !ok {
+		return
+	}
+
+	hook, err := db.GetDeployHook(h.DB, site.ID, chi.URLParam(r, "hookId"))
+	if err != nil {
+		jsonError(w, "hook-not-found", http.StatusNotFound)
+		return
+	}
+
+	triggers, err := db.ListDeployHookTriggers(h.DB, hook.ID, 50)
+	if err != nil {
+		jsonError(w, "list-triggers-failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"triggers": triggers,
+	})
+}
+
+func hookRef(r *http.Request) string {
+	ref := r.URL.Query().Get("ref")
+	if ref == "" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req struct {
+			Ref string `json:"ref"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		ref = req.Ref
+	}
+	return strings.TrimPrefix(strings.TrimSpace(ref), "refs/heads/")
+}
+
+func (h *DeployHooksHandler) Trigger(w http.ResponseWriter, r *http.Request) {
+	hook, err := db.GetDeployHookByToken(h.DB, chi.URLParam(r, "token"))
+	if err != nil {
+		jsonError(w, "hook-not-found", http.StatusNotFound)
+		return
+	}
+
+	if !h.Limiter.Allow(hook.ID) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(h.Limiter.Window().Seconds())))
+		jsonError(w, "rate-limited", http.StatusTooManyRequests)
+		return
+	}
+
+	site, err := db.GetSiteByIDAdmin(h.DB, hook.SiteID)
+	if err != nil {
+		jsonError(w, "site-not-found", http.StatusNotFound)
+		return
+	}
+	if user, err := db.GetUserByID(h.DB, site.UserID); err != nil || user.Banned {
+		jsonError(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	ref := hookRef(r)
+	preview := ref != "" && ref != deploy.ProductionBranch(site)
+	if preview {
+		if enabled, err := db.GetSitePreviewsEnabled(h.DB, site.ID); err != nil || !enabled {
+			jsonError(w, "previews-disabled", http.StatusConflict)
+			return
+		}
+	}
+
+	var d *db.Deployment
+	if preview {
+		d, err = h.Engine.DeployPreview(site.ID, site.UserID, db.PreviewBranch, ref, 0, nil)
+	} else {
+		d, err = h.Engine.DeploySite(site.ID, site.UserID, nil)
+	}
+
+	status, errMsg, deployID := db.HookTriggerDeployed, "", ""
+	if err != nil {
+		status, errMsg = db.HookTriggerFailed, err.Error()
+	} else {
+		deployID = d.ID
+	}
+	if recErr := db.RecordDeployHookTrigger(h.DB, cuid2.Generate(), hook.ID, deployID, ref, middleware.ClientIP(r, h.TrustProxy), r.UserAgent(), status, errMsg); recErr != nil {
+		fmt.Printf("Warning: failed to record deploy hook trigger for %s: %v\n", hook.ID, recErr)
+	}
+
+	switch {
+	case errors.Is(err, deploy.ErrPreviewsUnavailable):
+		jsonError(w, "previews-unavailable", http.StatusConflict)
+		return
+	case err != nil:
+		fmt.Printf("Warning: deploy hook %s failed for site %s: %v\n", hook.ID, site.ID, err)
+		jsonError(w, "deploy-failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":           true,
+		"deploymentId": d.ID,
+		"status":       d.Status,
+		"preview":      preview,
+	})
+}
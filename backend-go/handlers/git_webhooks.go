@@ -0,0 +1,377 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"boop-cat/db"
+	"boop-cat/deploy"
+	"boop-cat/lib"
+	"boop-cat/middleware"
+)
+
+const (
+	providerGitLab  = "gitlab"
+	providerGitea   = "gitea"
+	providerForgejo = "forgejo"
+	providerTangled = "tangled"
+
+	tangledRefUpdate = "sh.tangled.git.refUpdate"
+
+	maxWebhookBody = 5 << 20
+)
+
+var gitWebhookProviders = []string{providerGitLab, providerGitea, providerForgejo, providerTangled}
+
+type GitWebhooksHandler struct {
+	DB     *sql.DB
+	Engine *deploy.Engine
+}
+
+func NewGitWebhooksHandler(database *sql.DB, engine *deploy.Engine) *GitWebhooksHandler {
+	return &GitWebhooksHandler{DB: database, Engine: engine}
+}
+
+func (h *GitWebhooksHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Post("/{provider}/{siteId}", h.HandleWebhook)
+	return r
+}
+
+func gitWebhookURLs(siteID string) map[string]string {
+	base := strings.TrimRight(os.Getenv("PUBLIC_URL"), "/")
+	urls := make(map[string]string, len(gitWebhookProviders))
+	for _, provider := range gitWebhookProviders {
+		urls[provider] = fmt.Sprintf("%s/api/git/webhook/%s/%s", base, provider, siteID)
+	}
+	return urls
+}
+
+func (h *GitWebhooksHandler) ownedSite(w http.ResponseWriter, r *http.Request) (*db.Site, bool) {
+	userID := middleware.GetUserID(r.Context())
+	site, err := db.GetSiteByID(h.DB, userID, chi.URLParam(r, "siteId"))
+	if err != nil || site == nil {
+		jsonError(w, "site-not-found", http.StatusNotFound)
+		return nil, false
+	}
+	return site, true
+}
+
+func (h *GitWebhooksHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	site, ok := h.ownedSite(w, r)
+	if !ok {
+		return
+	}
+
+	resp := map[string]interface{}{
+		"enabled": false,
+		"urls":    gitWebhookURLs(site.ID),
+	}
+	if hook, err := db.GetSiteGitWebhook(h.DB, site.ID); err == nil {
+		resp["enabled"] = true
+		resp["createdAt"] = hook.CreatedAt
+		resp["lastDeliveryAt"] = hook.LastDeliveryAt
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *GitWebhooksHandler) RotateSecret(w http.ResponseWriter, r *http.Request) {
+	site, ok := h.ownedSite(w, r)
+	if !ok {
+		return
+	}
+
+	secret := generateToken()
+	if err := db.SetSiteGitWebhookSecret(h.DB, site.ID, lib.Encrypt(secret)); err != nil {
+		jsonError(w, "update-failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled": true,
+		"secret":  secret,
+		"urls":    gitWebhookURLs(site.ID),
+	})
+}
+
+func (h *GitWebhooksHandler) DisableWebhook(w http.ResponseWriter, r *http.Request) {
+	site, ok := h.ownedSite(w, r)
+	if !ok {
+		return
+	}
+
+	if err := db.DeleteSiteGitWebhook(h.DB, site.ID); err != nil {
+		jsonError(w, "delete-failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
+
+func verifyHexSignature(payload []byte, signature, secret string) bool {
+	if signature == "" || secret == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected))
+}
+
+func verifyGitWebhook(provider string, header http.Header, body []byte, secret string) (eventType string, verified, known bool) {
+	switch provider {
+	case providerGitLab:
+		token := header.Get("X-Gitlab-Token")
+		verified = token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+		return header.Get("X-Gitlab-Event"), verified, true
+	case providerGitea, providerForgejo:
+		signature := header.Get("X-Forgejo-Signature")
+		if signature == "" {
+			signature = header.Get("X-Gitea-Signature")
+		}
+		eventType = header.Get("X-Forgejo-Event")
+		if eventType == "" {
+			eventType = header.Get("X-Gitea-Event")
+		}
+		return eventType, verifyHexSignature(body, signature, secret), true
+	case providerTangled:
+		return header.Get("X-Tangled-Event"), verifySignature(body, header.Get("X-Tangled-Signature-256"), secret), true
+	}
+	return "", false, false
+}
+
+func (h *GitWebhooksHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	siteID := chi.URLParam(r, "siteId")
+
+	hook, err := db.GetSiteGitWebhook(h.DB, siteID)
+	if err != nil {
+		jsonError(w, "webhook-not-found", http.StatusNotFound)
+		return
+	}
+	secret := lib.Decrypt(hook.Secret)
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "read-failed", http.StatusInternalServerError)
+		return
+	}
+
+	eventType, verified, known := verifyGitWebhook(provider, r.Header, body, secret)
+	if !known {
+		jsonError(w, "unknown-provider", http.StatusNotFound)
+		return
+	}
+	if !verified {
+		http.Error(w, "invalid-signature", http.StatusUnauthorized)
+		return
+	}
+
+	site, err := db.GetSiteByIDAdmin(h.DB, siteID)
+	if err != nil {
+		jsonError(w, "site-not-found", http.StatusNotFound)
+		return
+	}
+	db.TouchSiteGitWebhook(h.DB, siteID)
+
+	var ev *PushEvent
+	switch provider {
+	case providerGitLab:
+		ev, err = parseGitLabPush(eventType, body)
+	case providerGitea, providerForgejo:
+		ev, err = parseGiteaPush(eventType, body)
+	case providerTangled:
+		ev, err = parseTangledPush(eventType, body, site)
+	}
+	if err != nil {
+		http.Error(w, "invalid-json", http.StatusBadRequest)
+		return
+	}
+	if ev == nil {
+		w.Write([]byte(`{"ok":true,"ignored":true}`))
+		return
+	}
+	ev.Provider = provider
+
+	result, err := dispatchPush(h.DB, h.Engine, *ev, site.UserID)
+	if err != nil {
+		fmt.Printf("[Webhook] Failed to find sites: %v\n", err)
+		http.Error(w, "db-error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+type pushCommit struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	Author  struct {
+		Name string `json:"name"`
+	} `json:"author"`
+}
+
+func parseGitLabPush(eventType string, body []byte) (*PushEvent, error) {
+	if eventType != "Push Hook" {
+		return nil, nil
+	}
+
+	var payload struct {
+		ObjectKind  string       `json:"object_kind"`
+		Ref         string       `json:"ref"`
+		After       string       `json:"after"`
+		CheckoutSHA string       `json:"checkout_sha"`
+		UserName    string       `json:"user_name"`
+		Commits     []pushCommit `json:"commits"`
+		Project     struct {
+			GitHTTPURL string `json:"git_http_url"`
+		} `json:"project"`
+		Repository struct {
+			GitHTTPURL string `json:"git_http_url"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	branch, ok := branchFromRef(payload.Ref)
+	if payload.ObjectKind != "push" || !ok {
+		return nil, nil
+	}
+
+	ev := &PushEvent{
+		RepoURL: payload.Project.GitHTTPURL,
+		Branch:  branch,
+		Deleted: isZeroSHA(payload.After),
+		Author:  payload.UserName,
+	}
+	if ev.RepoURL == "" {
+		ev.RepoURL = payload.Repository.GitHTTPURL
+	}
+	if ev.RepoURL == "" {
+		return nil, nil
+	}
+	if ev.Deleted {
+		return ev, nil
+	}
+
+	ev.CommitSHA = payload.CheckoutSHA
+	if ev.CommitSHA == "" {
+		ev.CommitSHA = payload.After
+	}
+	for _, c := range payload.Commits {
+		if c.ID == ev.CommitSHA {
+			ev.Message = c.Message
+			ev.Author = c.Author.Name
+		}
+	}
+	return ev, nil
+}
+
+func parseGiteaPush(eventType string, body []byte) (*PushEvent, error) {
+	var payload struct {
+		Ref        string      `json:"ref"`
+		RefType    string      `json:"ref_type"`
+		After      string      `json:"after"`
+		HeadCommit *pushCommit `json:"head_commit"`
+		Repository struct {
+			CloneURL string `json:"clone_url"`
+		} `json:"repository"`
+	}
+
+	switch eventType {
+	case "push", "delete":
+	default:
+		return nil, nil
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	if payload.Repository.CloneURL == "" {
+		return nil, nil
+	}
+
+	if eventType == "delete" {
+		if payload.RefType != "branch" || payload.Ref == "" {
+			return nil, nil
+		}
+		return &PushEvent{
+			RepoURL: payload.Repository.CloneURL,
+			Branch:  strings.TrimPrefix(payload.Ref, "refs/heads/"),
+			Deleted: true,
+		}, nil
+	}
+
+	branch, ok := branchFromRef(payload.Ref)
+	if !ok {
+		return nil, nil
+	}
+
+	ev := &PushEvent{
+		RepoURL:   payload.Repository.CloneURL,
+		Branch:    branch,
+		CommitSHA: payload.After,
+		Deleted:   isZeroSHA(payload.After),
+	}
+	if payload.HeadCommit != nil && !ev.Deleted {
+		ev.CommitSHA = payload.HeadCommit.ID
+		ev.Message = payload.HeadCommit.Message
+		ev.Author = payload.HeadCommit.Author.Name
+	}
+	return ev, nil
+}
+
+func parseTangledPush(eventType string, body []byte, site *db.Site) (*PushEvent, error) {
+	// Knots describe pushes with the sh.tangled.git.refUpdate record, which
+	// identifies the repository by name and owner DID rather than by URL.
+	if eventType != tangledRefUpdate && eventType != "" && eventType != "push" {
+		return nil, nil
+	}
+
+	var payload struct {
+		Ref          string `json:"ref"`
+		OldSha       string `json:"oldSha"`
+		NewSha       string `json:"newSha"`
+		RepoName     string `json:"repoName"`
+		CommitterDid string `json:"committerDid"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	branch, ok := branchFromRef(payload.Ref)
+	if !ok || !site.GitURL.Valid || payload.RepoName == "" {
+		return nil, nil
+	}
+	if !strings.EqualFold(strings.TrimSuffix(path.Base(site.GitURL.String), ".git"), payload.RepoName) {
+		return nil, nil
+	}
+
+	return &PushEvent{
+		RepoURL:   site.GitURL.String,
+		Branch:    branch,
+		CommitSHA: payload.NewSha,
+		Author:    payload.CommitterDid,
+		Deleted:   isZeroSHA(payload.NewSha),
+	}, nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+
+	"boop-cat/db"
+)
+
+func testHMAC(body, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySignature(t *testing.T) {
+	const body = `{"ref":"refs/heads/main"}`
+	valid := "sha256=" + testHMAC(body, "s3cret")
+
+	tests := []struct {
+		name      string
+		signature string
+		secret    string
+		want      bool
+	}{
+		{"valid", valid, "s3cret", true},
+		{"wrong secret", valid, "other", false},
+		{"missing prefix", testHMAC(body, "s3cret"), "s3cret", false},
+		{"uppercase hex", "sha256=" + strings.ToUpper(testHMAC(body, "s3cret")), "s3cret", false},
+		{"sha1 signature", "sha1=" + testHMAC(body, "s3cret"), "s3cret", false},
+		{"empty signature", "", "s3cret", false},
+		{"empty secret", "sha256=" + testHMAC(body, ""), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifySignature([]byte(body), tt.signature, tt.secret); got != tt.want {
+				t.Errorf("verifySignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyHexSignature(t *testing.T) {
+	const body = `{"ref":"refs/heads/main"}`
+	valid := testHMAC(body, "s3cret")
+
+	tests := []struct {
+		name      string
+		signature string
+		secret    string
+		want      bool
+	}{
+		{"valid", valid, "s3cret", true},
+		{"uppercase hex", strings.ToUpper(valid), "s3cret", true},
+		{"sha256 prefix", "sha256=" + valid, "s3cret", false},
+		{"wrong secret", valid, "other", false},
+		{"truncated", valid[:len(valid)-2], "s3cret", false},
+		{"empty signature", "", "s3cret", false},
+		{"empty secret", testHMAC(body, ""), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyHexSignature([]byte(body), tt.signature, tt.secret); got != tt.want {
+				t.Errorf("verifyHexSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyGitWebhook(t *testing.T) {
+	const body = `{"ref":"refs/heads/main"}`
+	const secret = "s3cret"
+	sig := testHMAC(body, secret)
+
+	tests := []struct {
+		name         string
+		provider     string
+		header       map[string]string
+		wantEvent    string
+		wantVerified bool
+		wantKnown    bool
+	}{
+		{"gitlab token", providerGitLab,
+			map[string]string{"X-Gitlab-Token": secret, "X-Gitlab-Event": "Push Hook"}, "Push Hook", true, true},
+		{"gitlab wrong token", providerGitLab,
+			map[string]string{"X-Gitlab-Token": "nope", "X-Gitlab-Event": "Push Hook"}, "Push Hook", false, true},
+		{"gitlab missing token", providerGitLab,
+			map[string]string{"X-Gitlab-Event": "Push Hook"}, "Push Hook", false, true},
+		{"forgejo headers", providerForgejo,
+			map[string]string{"X-Forgejo-Signature": sig, "X-Forgejo-Event": "push"}, "push", true, true},
+		{"gitea headers", providerGitea,
+			map[string]string{"X-Gitea-Signature": sig, "X-Gitea-Event": "push"}, "push", true, true},
+		{"gitea bad signature", providerGitea,
+			map[string]string{"X-Gitea-Signature": testHMAC(body, "other"), "X-Gitea-Event": "push"}, "push", false, true},
+		{"tangled", providerTangled,
+			map[string]string{"X-Tangled-Signature-256": "sha256=" + sig, "X-Tangled-Event": "sh.tangled.git.refUpdate"},
+			"sh.tangled.git.refUpdate", true, true},
+		{"tangled without prefix", providerTangled,
+			map[string]string{"X-Tangled-Signature-256": sig}, "", false, true},
+		{"github signature on gitlab route", providerGitLab,
+			map[string]string{"X-Hub-Signature-256": "sha256=" + sig}, "", false, true},
+		{"unknown provider", "bitbucket",
+			map[string]string{"X-Hub-Signature-256": "sha256=" + sig}, "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+			event, verified, known := verifyGitWebhook(tt.provider, header, []byte(body), secret)
+			if event != tt.wantEvent || verified != tt.wantVerified || known != tt.wantKnown {
+				t.Errorf("verifyGitWebhook() = %q, %v, %v, want %q, %v, %v",
+					event, verified, known, tt.wantEvent, tt.wantVerified, tt.wantKnown)
+			}
+		})
+	}
+}
+
+func TestTangledRefUpdatePush(t *testing.T) {
+	const secret = "s3cret"
+	const newSha = "9f1c2e7b3a4d5e6f708192a3b4c5d6e7f8091a2b"
+	site := &db.Site{GitURL: sql.NullString{String: "https://tangled.sh/@alice.example.com/blog", Valid: true}}
+
+	tests := []struct {
+		name       string
+		event      string
+		body       string
+		wantBranch string
+		wantDelete bool
+	}{
+		{"ref update", tangledRefUpdate,
+			`{"ref":"refs/heads/main","oldSha":"0000000000000000000000000000000000000000","newSha":"` + newSha +
+				`","repoName":"blog","committerDid":"did:plc:alice"}`, "main", false},
+		{"no event header", "",
+			`{"ref":"refs/heads/dev","newSha":"` + newSha + `","repoName":"Blog","committerDid":"did:plc:alice"}`, "dev", false},
+		{"branch deleted", tangledRefUpdate,
+			`{"ref":"refs/heads/old","oldSha":"` + newSha + `","newSha":"0000000000000000000000000000000000000000","repoName":"blog"}`,
+			"old", true},
+		{"other repository", tangledRefUpdate,
+			`{"ref":"refs/heads/main","newSha":"` + newSha + `","repoName":"other"}`, "", false},
+		{"tag push", tangledRefUpdate,
+			`{"ref":"refs/tags/v1","newSha":"` + newSha + `","repoName":"blog"}`, "", false},
+		{"unrelated event", "sh.tangled.repo.issue",
+			`{"ref":"refs/heads/main","newSha":"` + newSha + `","repoName":"blog"}`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("X-Tangled-Signature-256", "sha256="+testHMAC(tt.body, secret))
+			if tt.event != "" {
+				header.Set("X-Tangled-Event", tt.event)
+			}
+
+			eventType, verified, known := verifyGitWebhook(providerTangled, header, []byte(tt.body), secret)
+			if !verified || !known {
+				t.Fatalf("verifyGitWebhook() verified = %v, known = %v", verified, known)
+			}
+			ev, err := parseTangledPush(eventType, []byte(tt.body), site)
+			if err != nil {
+				t.Fatalf("parseTangledPush() error = %v", err)
+			}
+			if tt.wantBranch == "" {
+				if ev != nil {
+					t.Fatalf("parseTangledPush() = %+v, want ignored", ev)
+				}
+				return
+			}
+			if ev == nil {
+				t.Fatal("parseTangledPush() ignored the push")
+			}
+			if ev.Branch != tt.wantBranch || ev.Deleted != tt.wantDelete || ev.RepoURL != site.GitURL.String {
+				t.Errorf("parseTangledPush() = %+v, want branch %s deleted %v", ev, tt.wantBranch, tt.wantDelete)
+			}
+			if !tt.wantDelete && ev.CommitSHA != newSha {
+				t.Errorf("CommitSHA = %s, want %s", ev.CommitSHA, newSha)
+			}
+		})
+	}
+}
@@ -80,6 +80,11 @@ func (h *GitHubWebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if eventType == "pull_request" {
+		h.handlePullRequest(w, event)
+		return
+	}
+
 	if eventType == "installation" {
 		h.handleInstallation(w, event)
 		return
@@ -99,35 +104,80 @@ func (h *GitHubWebhookHandler) handlePush(w http.ResponseWriter, event map[strin
 	repoURL, _ := repoMap["clone_url"].(string)
 
 	ref, _ := event["ref"].(string)
-	branch := strings.TrimPrefix(ref, "refs/heads/")
+	branch, ok := branchFromRef(ref)
 
-	if repoURL == "" || branch == "" {
+	if repoURL == "" || !ok {
 		w.Write([]byte(`{"ok":true,"ignored":"no-url-or-branch"}`))
 		return
 	}
 
-	sites, err := db.GetSitesByRepo(h.DB, repoURL, branch)
+	ev := PushEvent{Provider: "github", RepoURL: repoURL, Branch: branch}
+	ev.Deleted, _ = event["deleted"].(bool)
+	if commit, _ := event["head_commit"].(map[string]interface{}); commit != nil {
+		ev.CommitSHA, _ = commit["id"].(string)
+		ev.Message, _ = commit["message"].(string)
+		author, _ := commit["author"].(map[string]interface{})
+		ev.Author, _ = author["name"].(string)
+	}
+
+	result, err := dispatchPush(h.DB, h.Engine, ev, "")
 	if err != nil {
 		fmt.Printf("[Webhook] Failed to find sites: %v\n", err)
 		http.Error(w, "db-error", http.StatusInternalServerError)
 		return
 	}
+	json.NewEncoder(w).Encode(result)
+}
+
+func (h *GitHubWebhookHandler) handlePullRequest(w http.ResponseWriter, event map[string]interface{}) {
+	action, _ := event["action"].(string)
+	number, _ := event["number"].(float64)
+	pr, _ := event["pull_request"].(map[string]interface{})
+	repoMap, _ := event["repository"].(map[string]interface{})
+	if pr == nil || repoMap == nil || number <= 0 {
+		w.Write([]byte(`{"ok":true,"ignored":"no-pull-request"}`))
+		return
+	}
+
+	repoURL, _ := repoMap["clone_url"].(string)
+	repoName, _ := repoMap["full_name"].(string)
+	head, _ := pr["head"].(map[string]interface{})
+	headRef, _ := head["ref"].(string)
+	headRepo, _ := head["repo"].(map[string]interface{})
+	headName, _ := headRepo["full_name"].(string)
+
+	switch action {
+	case "closed":
+		removed := removePreviews(h.DB, h.Engine, repoURL, "", db.PreviewPullRequest, "", int(number))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":      true,
+			"removed": removed,
+		})
+		return
+	case "opened", "reopened", "synchronize":
+	default:
+		w.Write([]byte(`{"ok":true,"ignored":"action"}`))
+		return
+	}
+
+	if headRef == "" || !strings.EqualFold(headName, repoName) {
+		w.Write([]byte(`{"ok":true,"ignored":"fork"}`))
+		return
+	}
 
-	processed := 0
-	for _, site := range sites {
-		fmt.Printf("[Webhook] Triggering deploy for site %s\n", site.ID)
-		_, err := h.Engine.DeploySite(site.ID, site.UserID, nil)
-		if err != nil {
-			fmt.Printf("[Webhook] Deploy failed for %s: %v\n", site.ID, err)
+	previews := 0
+	for _, site := range previewSites(h.DB, repoURL, "") {
+		fmt.Printf("[Webhook] Triggering preview of pull request #%d for site %s\n", int(number), site.ID)
+		if _, err := h.Engine.DeployPreview(site.ID, site.UserID, db.PreviewPullRequest, headRef, int(number), nil); err != nil {
+			fmt.Printf("[Webhook] Preview failed for %s: %v\n", site.ID, err)
 		} else {
-			processed++
+			previews++
 		}
 	}
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"ok":       true,
-		"deployed": processed,
-		"matched":  len(sites),
+		"previews": previews,
 	})
 }
 
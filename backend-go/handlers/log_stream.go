@@ -0,0 +1,157 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"boop-cat/db"
+	"boop-cat/deploy"
+	"boop-cat/middleware"
+)
+
+const logStreamHeartbeat = 15 * time.Second
+
+func (h *DeployHandler) deploymentInProgress(deployID string) bool {
+	job, err := db.GetDeploymentJob(h.DB, deployID)
+	if err != nil {
+		return false
+	}
+	return job.InProgress()
+}
+
+func (h *DeployHandler) StreamDeploymentLogs(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	deployID := chi.URLParam(r, "id")
+
+	d, err := db.GetDeploymentByID(h.DB, deployID)
+	if err != nil {
+		http.Error(w, "not-found", http.StatusNotFound)
+		return
+	}
+	if d.UserID != userID {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming-unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	last, _ := strconv.Atoi(lastEventID)
+	if last < 0 {
+		last = 0
+	}
+
+	lines, unsubscribe := h.Engine.SubscribeLogs(deployID)
+	defer func() { unsubscribe() }()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	structured := r.URL.Query().Get("format") == "json"
+	send := func(rec deploy.LogRecord) error {
+		data := rec.String()
+		if structured {
+			encoded, _ := json.Marshal(rec)
+			data = string(encoded)
+		}
+		_, err := fmt.Fprintf(w, "id: %d\nevent: log\ndata: %s\n\n", rec.N, strings.ReplaceAll(data, "\r", ""))
+		return err
+	}
+	catchUp := func() error {
+		if d, err = db.GetDeploymentByID(h.DB, deployID); err != nil {
+			return err
+		}
+		last, err = deploy.ReadLogRecords(d.LogsPath.String, last, send)
+		flusher.Flush()
+		return err
+	}
+	finish := func() {
+		data, _ := json.Marshal(map[string]interface{}{
+			"id":     d.ID,
+			"status": d.Status,
+			"url":    d.ToResponse().URL,
+		})
+		fmt.Fprintf(w, "event: end\ndata: %s\n\n", data)
+		flusher.Flush()
+	}
+
+	done := !h.deploymentInProgress(deployID)
+	if err := catchUp(); err != nil {
+		return
+	}
+	if done {
+		finish()
+		return
+	}
+
+	ticker := time.NewTicker(logStreamHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case line, ok := <-lines:
+			if !ok {
+				done := !h.deploymentInProgress(deployID)
+				if err := catchUp(); err != nil {
+					return
+				}
+				if done {
+					finish()
+					return
+				}
+				lines, unsubscribe = h.Engine.SubscribeLogs(deployID)
+				continue
+			}
+			if line.N <= last {
+				continue
+			}
+			if line.N > last+1 {
+				if err := catchUp(); err != nil {
+					return
+				}
+				if line.N <= last {
+					continue
+				}
+			}
+			if send(line) != nil {
+				return
+			}
+			last = line.N
+			flusher.Flush()
+
+		case <-ticker.C:
+			if !h.deploymentInProgress(deployID) {
+				if catchUp() == nil {
+					finish()
+				}
+				return
+			}
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
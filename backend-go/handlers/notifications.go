@@ -0,0 +1,107 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"boop-cat/db"
+	"boop-cat/lib"
+	"boop-cat/middleware"
+)
+
+func decryptNotificationSettings(n *db.NotificationSettings) {
+	n.DiscordWebhookURL = lib.Decrypt(n.DiscordWebhookURL)
+	n.SlackWebhookURL = lib.Decrypt(n.SlackWebhookURL)
+	n.WebhookURL = lib.Decrypt(n.WebhookURL)
+}
+
+func (h *AccountHandler) GetNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	settings, err := db.GetNotificationSettings(h.DB, userID)
+	if err != nil {
+		jsonError(w, "db-error", http.StatusInternalServerError)
+		return
+	}
+	decryptNotificationSettings(settings)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"settings":        settings,
+		"availableEvents": db.DefaultNotificationEvents,
+	})
+}
+
+func (h *AccountHandler) UpdateNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	settings, err := db.GetNotificationSettings(h.DB, userID)
+	if err != nil {
+		jsonError(w, "db-error", http.StatusInternalServerError)
+		return
+	}
+	decryptNotificationSettings(settings)
+
+	var req struct {
+		Events            *[]string `json:"events"`
+		EmailEnabled      *bool     `json:"emailEnabled"`
+		DiscordWebhookURL *string   `json:"discordWebhookUrl"`
+		SlackWebhookURL   *string   `json:"slackWebhookUrl"`
+		WebhookURL        *string   `json:"webhookUrl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid-json", http.StatusBadRequest)
+		return
+	}
+
+	if req.Events != nil {
+		for _, event := range *req.Events {
+			if event != db.NotifyDeploymentFailed && event != db.NotifyDeploymentRecovered {
+				jsonError(w, "invalid-events", http.StatusBadRequest)
+				return
+			}
+		}
+		settings.Events = *req.Events
+	}
+	if req.EmailEnabled != nil {
+		settings.EmailEnabled = *req.EmailEnabled
+	}
+
+	for _, field := range []struct {
+		value *string
+		dest  *string
+	}{
+		{req.DiscordWebhookURL, &settings.DiscordWebhookURL},
+		{req.SlackWebhookURL, &settings.SlackWebhookURL},
+		{req.WebhookURL, &settings.WebhookURL},
+	} {
+		if field.value == nil {
+			continue
+		}
+		url := strings.TrimSpace(*field.value)
+		if url != "" && !validWebhookURL(url) {
+			jsonError(w, "invalid-url", http.StatusBadRequest)
+			return
+		}
+		*field.dest = url
+	}
+
+	stored := *settings
+	stored.DiscordWebhookURL = lib.Encrypt(settings.DiscordWebhookURL)
+	stored.SlackWebhookURL = lib.Encrypt(settings.SlackWebhookURL)
+	stored.WebhookURL = lib.Encrypt(settings.WebhookURL)
+	if err := db.SaveNotificationSettings(h.DB, &stored); err != nil {
+		jsonError(w, "update-failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"settings": settings,
+	})
+}
@@ -0,0 +1,159 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"boop-cat/db"
+	"boop-cat/deploy"
+	"boop-cat/middleware"
+)
+
+type previewResponse struct {
+	db.SitePreview
+	URL string `json:"url"`
+}
+
+func (h *DeployHandler) ListPreviews(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	siteID := chi.URLParam(r, "siteId")
+
+	site, err := db.GetSiteByID(h.DB, userID, siteID)
+	if err != nil || site == nil {
+		jsonError(w, "site-not-found", http.StatusNotFound)
+		return
+	}
+
+	enabled, err := db.GetSitePreviewsEnabled(h.DB, siteID)
+	if err != nil {
+		jsonError(w, "list-previews-failed", http.StatusInternalServerError)
+		return
+	}
+	previews, err := db.ListSitePreviews(h.DB, siteID)
+	if err != nil {
+		jsonError(w, "list-previews-failed", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]previewResponse, 0, len(previews))
+	for _, p := range previews {
+		resp = append(resp, previewResponse{SitePreview: p, URL: deploy.PreviewURL(p.Host)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":  enabled,
+		"previews": resp,
+	})
+}
+
+func (h *DeployHandler) UpdatePreviewSettings(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	siteID := chi.URLParam(r, "siteId")
+
+	site, err := db.GetSiteByID(h.DB, userID, siteID)
+	if err != nil || site == nil {
+		jsonError(w, "site-not-found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid-json", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.SetSitePreviewsEnabled(h.DB, siteID, req.Enabled); err != nil {
+		jsonError(w, "update-failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled": req.Enabled,
+	})
+}
+
+func (h *DeployHandler) CreatePreview(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	siteID := chi.URLParam(r, "siteId")
+
+	site, err := db.GetSiteByID(h.DB, userID, siteID)
+	if err != nil || site == nil {
+		jsonError(w, "site-not-found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Branch string `json:"branch"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid-json", http.StatusBadRequest)
+		return
+	}
+	req.Branch = strings.TrimSpace(req.Branch)
+	if req.Branch == "" {
+		jsonError(w, "branch-required", http.StatusBadRequest)
+		return
+	}
+
+	d, err := h.Engine.DeployPreview(siteID, userID, db.PreviewBranch, req.Branch, 0, nil)
+	switch {
+	case errors.Is(err, deploy.ErrPreviewProductionBranch):
+		jsonError(w, "production-branch", http.StatusConflict)
+		return
+	case errors.Is(err, deploy.ErrPreviewsUnavailable):
+		jsonError(w, "previews-unavailable", http.StatusConflict)
+		return
+	case err != nil:
+		fmt.Printf("Warning: preview deploy failed for site %s: %v\n", siteID, err)
+		jsonError(w, "deploy-failed", http.StatusInternalServerError)
+		return
+	}
+
+	resp := d.ToResponse()
+	resp.SetQueuePosition(h.Engine.QueuePositions())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *DeployHandler) DeletePreview(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	siteID := chi.URLParam(r, "siteId")
+
+	site, err := db.GetSiteByID(h.DB, userID, siteID)
+	if err != nil || site == nil {
+		jsonError(w, "site-not-found", http.StatusNotFound)
+		return
+	}
+
+	preview, err := db.GetSitePreview(h.DB, chi.URLParam(r, "previewId"))
+	if err == sql.ErrNoRows || (err == nil && preview.SiteID != siteID) {
+		jsonError(w, "preview-not-found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		jsonError(w, "delete-failed", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.Engine.TeardownPreview(preview.ID); err != nil {
+		fmt.Printf("Warning: failed to remove preview %s: %v\n", preview.Host, err)
+		jsonError(w, "delete-failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
@@ -0,0 +1,154 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"boop-cat/db"
+	"boop-cat/deploy"
+)
+
+type PushEvent struct {
+	Provider  string
+	RepoURL   string
+	Branch    string
+	CommitSHA string
+	Message   string
+	Author    string
+	Deleted   bool
+}
+
+func branchFromRef(ref string) (string, bool) {
+	if !strings.HasPrefix(ref, "refs/heads/") {
+		return "", false
+	}
+	branch := strings.TrimPrefix(ref, "refs/heads/")
+	return branch, branch != ""
+}
+
+func isZeroSHA(sha string) bool {
+	return sha != "" && strings.Trim(sha, "0") == ""
+}
+
+func dispatchPush(database *sql.DB, engine *deploy.Engine, ev PushEvent, ownerID string) (map[string]interface{}, error) {
+	if ev.Deleted {
+		return map[string]interface{}{
+			"ok":      true,
+			"removed": removePreviews(database, engine, ev.RepoURL, ownerID, db.PreviewBranch, ev.Branch, 0),
+		}, nil
+	}
+
+	sites, err := sitesForRepo(database, ev.RepoURL, ev.Branch, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	processed := 0
+	for _, site := range sites {
+		fmt.Printf("[Webhook] Triggering deploy for site %s (%s push)\n", site.ID, ev.Provider)
+		d, err := engine.DeploySite(site.ID, site.UserID, nil)
+		if err != nil {
+			fmt.Printf("[Webhook] Deploy failed for %s: %v\n", site.ID, err)
+			continue
+		}
+		recordPushCommit(database, d.ID, ev)
+		processed++
+	}
+
+	previews := 0
+	for _, site := range previewSites(database, ev.RepoURL, ownerID) {
+		if deploy.ProductionBranch(&site) == ev.Branch {
+			continue
+		}
+		fmt.Printf("[Webhook] Triggering preview of %s for site %s\n", ev.Branch, site.ID)
+		d, err := engine.DeployPreview(site.ID, site.UserID, db.PreviewBranch, ev.Branch, 0, nil)
+		if err != nil {
+			fmt.Printf("[Webhook] Preview failed for %s: %v\n", site.ID, err)
+			continue
+		}
+		recordPushCommit(database, d.ID, ev)
+		previews++
+	}
+
+	return map[string]interface{}{
+		"ok":       true,
+		"deployed": processed,
+		"matched":  len(sites),
+		"previews": previews,
+	}, nil
+}
+
+func recordPushCommit(database *sql.DB, deployID string, ev PushEvent) {
+	if ev.CommitSHA == "" {
+		return
+	}
+	if err := db.SetDeploymentCommitIfMissing(database, deployID, ev.CommitSHA, ev.Message, ev.Author); err != nil {
+		fmt.Printf("[Webhook] Failed to record commit for %s: %v\n", deployID, err)
+	}
+}
+
+func sitesForRepo(database *sql.DB, repoURL, branch, ownerID string) ([]db.Site, error) {
+	sites, err := db.GetSitesByRepo(database, repoURL, branch)
+	if err != nil || ownerID == "" {
+		return sites, err
+	}
+
+	var owned []db.Site
+	for _, site := range sites {
+		if site.UserID == ownerID {
+			owned = append(owned, site)
+		}
+	}
+	return owned, nil
+}
+
+func previewSites(database *sql.DB, repoURL, ownerID string) []db.Site {
+	sites, err := sitesForRepo(database, repoURL, "", ownerID)
+	if err != nil {
+		fmt.Printf("[Webhook] Failed to find sites: %v\n", err)
+		return nil
+	}
+
+	var enabled []db.Site
+	for _, site := range sites {
+		if ok, err := db.GetSitePreviewsEnabled(database, site.ID); err == nil && ok {
+			enabled = append(enabled, site)
+		}
+	}
+	return enabled
+}
+
+func removePreviews(database *sql.DB, engine *deploy.Engine, repoURL, ownerID, kind, branch string, prNumber int) int {
+	if repoURL == "" {
+		return 0
+	}
+	sites, err := sitesForRepo(database, repoURL, "", ownerID)
+	if err != nil {
+		fmt.Printf("[Webhook] Failed to find sites: %v\n", err)
+		return 0
+	}
+
+	var previews []db.SitePreview
+	for _, site := range sites {
+		found, err := db.FindSitePreviews(database, site.ID, kind, branch, prNumber)
+		if err != nil {
+			fmt.Printf("[Webhook] Failed to find previews for %s: %v\n", site.ID, err)
+			continue
+		}
+		previews = append(previews, found...)
+	}
+
+	go func() {
+		for _, p := range previews {
+			if err := engine.TeardownPreview(p.ID); err != nil {
+				fmt.Printf("[Webhook] Failed to remove preview %s: %v\n", p.Host, err)
+			}
+		}
+	}()
+	return len(previews)
+}
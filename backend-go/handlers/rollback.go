@@ -0,0 +1,163 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"boop-cat/db"
+	"boop-cat/deploy"
+	"boop-cat/middleware"
+)
+
+func promoteDeployment(w http.ResponseWriter, engine *deploy.Engine, siteID, deployID, actorID, via string) {
+	d, err := engine.Promote(siteID, deployID, actorID, via)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		jsonError(w, "deployment-not-found", http.StatusNotFound)
+		return
+	case errors.Is(err, deploy.ErrNoPreviousDeployment):
+		jsonError(w, "no-previous-deployment", http.StatusConflict)
+		return
+	case errors.Is(err, deploy.ErrDeploymentNotPromotable):
+		jsonError(w, "deployment-not-promotable", http.StatusConflict)
+		return
+	case errors.Is(err, deploy.ErrDeploymentFilesMissing):
+		jsonError(w, "deployment-files-missing", http.StatusGone)
+		return
+	case err != nil:
+		fmt.Printf("Warning: promote failed for site %s: %v\n", siteID, err)
+		jsonError(w, "promote-failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d.ToResponse())
+}
+
+func rollbackTarget(r *http.Request) string {
+	var req struct {
+		DeploymentID string `json:"deploymentId"`
+	}
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&req)
+	}
+	return req.DeploymentID
+}
+
+func (h *DeployHandler) PromoteDeployment(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	siteID := chi.URLParam(r, "siteId")
+
+	site, err := db.GetSiteByID(h.DB, userID, siteID)
+	if err != nil || site == nil {
+		jsonError(w, "site-not-found", http.StatusNotFound)
+		return
+	}
+
+	promoteDeployment(w, h.Engine, siteID, chi.URLParam(r, "id"), userID, deploy.RollbackViaSession)
+}
+
+func (h *DeployHandler) RollbackSite(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	siteID := chi.URLParam(r, "siteId")
+
+	site, err := db.GetSiteByID(h.DB, userID, siteID)
+	if err != nil || site == nil {
+		jsonError(w, "site-not-found", http.StatusNotFound)
+		return
+	}
+
+	promoteDeployment(w, h.Engine, siteID, rollbackTarget(r), userID, deploy.RollbackViaSession)
+}
+
+func (h *DeployHandler) ListRollbacks(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	siteID := chi.URLParam(r, "siteId")
+
+	site, err := db.GetSiteByID(h.DB, userID, siteID)
+	if err != nil || site == nil {
+		jsonError(w, "site-not-found", http.StatusNotFound)
+		return
+	}
+
+	rollbacks, err := db.ListDeploymentRollbacks(h.DB, siteID)
+	if err != nil {
+		jsonError(w, "list-rollbacks-failed", http.StatusInternalServerError)
+		return
+	}
+	if rollbacks == nil {
+		rollbacks = []db.DeploymentRollback{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rollbacks": rollbacks,
+	})
+}
+
+func (h *APIV1Handler) PromoteDeployment(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	siteID := chi.URLParam(r, "id")
+
+	site, err := db.GetSiteByID(h.DB, userID, siteID)
+	if err != nil || site == nil {
+		jsonError(w, "site-not-found", http.StatusNotFound)
+		return
+	}
+
+	promoteDeployment(w, h.Engine, siteID, chi.URLParam(r, "deploymentId"), userID, deploy.RollbackViaAPI)
+}
+
+func (h *APIV1Handler) RollbackSite(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	siteID := chi.URLParam(r, "id")
+
+	site, err := db.GetSiteByID(h.DB, userID, siteID)
+	if err != nil || site == nil {
+		jsonError(w, "site-not-found", http.StatusNotFound)
+		return
+	}
+
+	promoteDeployment(w, h.Engine, siteID, rollbackTarget(r), userID, deploy.RollbackViaAPI)
+}
+
+func (h *DeployHandler) PinDeployment(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	siteID := chi.URLParam(r, "siteId")
+	deployID := chi.URLParam(r, "id")
+
+	site, err := db.GetSiteByID(h.DB, userID, siteID)
+	if err != nil || site == nil {
+		jsonError(w, "site-not-found", http.StatusNotFound)
+		return
+	}
+
+	d, err := db.GetDeploymentByID(h.DB, deployID)
+	if err != nil || d.SiteID != siteID {
+		jsonError(w, "deployment-not-found", http.StatusNotFound)
+		return
+	}
+	if d.Status == "expired" {
+		jsonError(w, "deployment-expired", http.StatusGone)
+		return
+	}
+
+	pinned := r.Method != http.MethodDelete
+	if err := db.SetDeploymentPinned(h.DB, deployID, pinned); err != nil {
+		jsonError(w, "pin-failed", http.StatusInternalServerError)
+		return
+	}
+	d.Pinned = pinned
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d.ToResponse())
+}
@@ -0,0 +1,111 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"boop-cat/db"
+	"boop-cat/deploy"
+	"boop-cat/lib"
+	"boop-cat/middleware"
+)
+
+const maxSecretEnvKeys = 200
+
+func (h *SitesHandler) GetSecretEnvKeys(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	siteID := chi.URLParam(r, "siteId")
+
+	site, err := db.GetSiteByID(h.DB, userID, siteID)
+	if err != nil || site == nil {
+		jsonError(w, "site-not-found", http.StatusNotFound)
+		return
+	}
+
+	keys, err := db.GetSiteSecretEnvKeys(h.DB, siteID)
+	if err != nil {
+		jsonError(w, "load-failed", http.StatusInternalServerError)
+		return
+	}
+
+	detected := []string{}
+	if site.EnvText.Valid && site.EnvText.String != "" {
+		for _, line := range strings.Split(lib.Decrypt(site.EnvText.String), "\n") {
+			idx := strings.Index(line, "=")
+			if idx <= 0 {
+				continue
+			}
+			if key := strings.TrimSpace(line[:idx]); !strings.HasPrefix(key, "#") && deploy.LooksSecretEnvKey(key) {
+				detected = append(detected, key)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"secretEnvKeys":   nonNilKeys(keys),
+		"detectedEnvKeys": detected,
+	})
+}
+
+func (h *SitesHandler) UpdateSecretEnvKeys(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	siteID := chi.URLParam(r, "siteId")
+
+	site, err := db.GetSiteByID(h.DB, userID, siteID)
+	if err != nil || site == nil {
+		jsonError(w, "site-not-found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		SecretEnvKeys []string `json:"secretEnvKeys"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid-json", http.StatusBadRequest)
+		return
+	}
+
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, key := range req.SecretEnvKeys {
+		key = strings.TrimSpace(key)
+		if key == "" || seen[key] {
+			continue
+		}
+		if strings.ContainsAny(key, "= \t\n") {
+			jsonError(w, "invalid-env-key", http.StatusBadRequest)
+			return
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	if len(keys) > maxSecretEnvKeys {
+		jsonError(w, "too-many-keys", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.SetSiteSecretEnvKeys(h.DB, siteID, keys); err != nil {
+		jsonError(w, "update-failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"secretEnvKeys": keys,
+	})
+}
+
+func nonNilKeys(keys []string) []string {
+	if keys == nil {
+		return []string{}
+	}
+	return keys
+}
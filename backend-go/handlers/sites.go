@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path"
 	"regexp"
 	"strings"
 
@@ -90,6 +91,13 @@ func (h *SitesHandler) CreateSite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	subdir, ok := cleanSubdir(req.Subdir)
+	if !ok {
+		jsonError(w, "invalid-subdir", http.StatusBadRequest)
+		return
+	}
+	req.Subdir = subdir
+
 	siteID := cuid2.Generate()
 
 	if req.Branch == "" {
@@ -114,6 +122,7 @@ func (h *SitesHandler) CreateSite(w http.ResponseWriter, r *http.Request) {
 			label := strings.ToLower(req.Name)
 			reg := regexp.MustCompile("[^a-z0-9-]")
 			label = reg.ReplaceAllString(label, "-")
+			label = regexp.MustCompile("-+").ReplaceAllString(label, "-")
 			label = strings.Trim(label, "-")
 			if label == "" {
 				label = "site"
@@ -122,6 +131,10 @@ func (h *SitesHandler) CreateSite(w http.ResponseWriter, r *http.Request) {
 		}
 
 		req.Domain = normalized
+		if deploy.ReservedSiteDomain(req.Domain) {
+			jsonError(w, "invalid-domain", http.StatusBadRequest)
+			return
+		}
 
 		baseLabel := strings.TrimSuffix(req.Domain, "."+edgeRoot)
 		for i := 0; i < 5; i++ {
@@ -219,6 +232,13 @@ func (h *SitesHandler) UpdateSiteSettings(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	subdir, ok := cleanSubdir(req.Subdir)
+	if !ok {
+		jsonError(w, "invalid-subdir", http.StatusBadRequest)
+		return
+	}
+	req.Subdir = subdir
+
 	if req.Name == "" {
 		req.Name = site.Name
 	}
@@ -249,6 +269,10 @@ func (h *SitesHandler) UpdateSiteSettings(w http.ResponseWriter, r *http.Request
 				req.Domain = normalized + "." + edgeRoot
 			}
 		}
+		if deploy.ReservedSiteDomain(req.Domain) {
+			jsonError(w, "invalid-domain", http.StatusBadRequest)
+			return
+		}
 	}
 
 	err = db.UpdateSiteSettings(h.DB, siteID, req.Name, req.Domain, req.GitURL, req.Branch, req.Subdir, req.BuildCommand, req.OutputDir)
@@ -296,3 +320,23 @@ func (h *SitesHandler) DeleteSite(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"ok":true}`))
 }
+
+func cleanSubdir(subdir string) (string, bool) {
+	subdir = strings.TrimSpace(subdir)
+	if subdir == "" {
+		return "", true
+	}
+	cleaned := path.Clean(subdir)
+	if path.IsAbs(cleaned) {
+		return "", false
+	}
+	for _, part := range strings.Split(cleaned, "/") {
+		if part == ".." {
+			return "", false
+		}
+	}
+	if cleaned == "." {
+		return "", true
+	}
+	return cleaned, true
+}
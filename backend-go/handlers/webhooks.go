@@ -0,0 +1,296 @@
+// Copyright 2025 boop.cat
+// Licensed under the Apache License, Version 2.0
+// See LICENSE file for details.
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nrednav/cuid2"
+
+	"boop-cat/db"
+	"boop-cat/deploy"
+	"boop-cat/lib"
+	"boop-cat/middleware"
+)
+
+const maxWebhookEndpoints = 20
+
+type WebhooksHandler struct {
+	DB     *sql.DB
+	Engine *deploy.Engine
+}
+
+func NewWebhooksHandler(database *sql.DB, engine *deploy.Engine) *WebhooksHandler {
+	return &WebhooksHandler{DB: database, Engine: engine}
+}
+
+func (h *WebhooksHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(middleware.RequireLogin)
+
+	r.Get("/", h.ListEndpoints)
+	r.Post("/", h.CreateEndpoint)
+	r.Patch("/{id}", h.UpdateEndpoint)
+	r.Delete("/{id}", h.DeleteEndpoint)
+	r.Post("/{id}/secret", h.RotateSecret)
+	r.Get("/{id}/deliveries", h.ListDeliveries)
+	r.Get("/{id}/deliveries/{deliveryId}", h.GetDelivery)
+	r.Post("/{id}/deliveries/{deliveryId}/replay", h.ReplayDelivery)
+
+	return r
+}
+
+func validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return u.Scheme == "https" || u.Scheme == "http"
+}
+
+func validWebhookEvents(events []string) bool {
+	for _, event := range events {
+		known := false
+		for _, e := range deploy.WebhookEvents {
+			if e == event {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *WebhooksHandler) ListEndpoints(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	endpoints, err := db.ListWebhookEndpoints(h.DB, userID)
+	if err != nil {
+		jsonError(w, "list-webhooks-failed", http.StatusInternalServerError)
+		return
+	}
+
+	if siteID := r.URL.Query().Get("siteId"); siteID != "" {
+		filtered := []db.WebhookEndpoint{}
+		for _, e := range endpoints {
+			if e.SiteID != nil && *e.SiteID == siteID {
+				filtered = append(filtered, e)
+			}
+		}
+		endpoints = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhooks": endpoints,
+		"events":   deploy.WebhookEvents,
+	})
+}
+
+func (h *WebhooksHandler) CreateEndpoint(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	var req struct {
+		URL    string   `json:"url"`
+		SiteID string   `json:"siteId"`
+		Events []string `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid-json", http.StatusBadRequest)
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if !validWebhookURL(req.URL) {
+		jsonError(w, "invalid-url", http.StatusBadRequest)
+		return
+	}
+	if !validWebhookEvents(req.Events) {
+		jsonError(w, "invalid-events", http.StatusBadRequest)
+		return
+	}
+	if req.SiteID != "" {
+		if site, err := db.GetSiteByID(h.DB, userID, req.SiteID); err != nil || site == nil {
+			jsonError(w, "site-not-found", http.StatusNotFound)
+			return
+		}
+	}
+
+	count, err := db.CountWebhookEndpoints(h.DB, userID)
+	if err != nil {
+		jsonError(w, "create-webhook-failed", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxWebhookEndpoints {
+		jsonError(w, "too-many-webhooks", http.StatusBadRequest)
+		return
+	}
+
+	id := cuid2.Generate()
+	secret := "whsec_" + generateToken()
+	if err := db.CreateWebhookEndpoint(h.DB, id, userID, req.SiteID, req.URL, lib.Encrypt(secret), req.Events); err != nil {
+		jsonError(w, "create-webhook-failed", http.StatusInternalServerError)
+		return
+	}
+
+	endpoint, _ := db.GetWebhookEndpoint(h.DB, userID, id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhook": endpoint,
+		"secret":  secret,
+	})
+}
+
+func (h *WebhooksHandler) UpdateEndpoint(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	endpoint, err := db.GetWebhookEndpoint(h.DB, userID, chi.URLParam(r, "id"))
+	if err != nil {
+		jsonError(w, "webhook-not-found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		URL     *string   `json:"url"`
+		Events  *[]string `json:"events"`
+		Enabled *bool     `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid-json", http.StatusBadRequest)
+		return
+	}
+	if req.URL != nil {
+		endpoint.URL = strings.TrimSpace(*req.URL)
+		if !validWebhookURL(endpoint.URL) {
+			jsonError(w, "invalid-url", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Events != nil {
+		if !validWebhookEvents(*req.Events) {
+			jsonError(w, "invalid-events", http.StatusBadRequest)
+			return
+		}
+		endpoint.Events = *req.Events
+	}
+	if req.Enabled != nil {
+		endpoint.Enabled = *req.Enabled
+	}
+
+	if err := db.UpdateWebhookEndpoint(h.DB, userID, endpoint.ID, endpoint.URL, endpoint.Events, endpoint.Enabled); err != nil {
+		jsonError(w, "update-failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(endpoint)
+}
+
+func (h *WebhooksHandler) DeleteEndpoint(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	err := db.DeleteWebhookEndpoint(h.DB, userID, chi.URLParam(r, "id"))
+	if err == sql.ErrNoRows {
+		jsonError(w, "webhook-not-found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		jsonError(w, "delete-failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
+
+func (h *WebhooksHandler) RotateSecret(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	secret := "whsec_" + generateToken()
+	err := db.SetWebhookEndpointSecret(h.DB, userID, chi.URLParam(r, "id"), lib.Encrypt(secret))
+	if err == sql.ErrNoRows {
+		jsonError(w, "webhook-not-found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		jsonError(w, "update-failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"secret": secret})
+}
+
+func (h *WebhooksHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	endpoint, err := db.GetWebhookEndpoint(h.DB, userID, chi.URLParam(r, "id"))
+	if err != nil {
+		jsonError(w, "webhook-not-found", http.StatusNotFound)
+		return
+	}
+
+	deliveries, err := db.ListWebhookDeliveries(h.DB, endpoint.ID, 100)
+	if err != nil {
+		jsonError(w, "list-deliveries-failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deliveries": deliveries,
+	})
+}
+
+func (h *WebhooksHandler) delivery(w http.ResponseWriter, r *http.Request) (*db.WebhookDelivery, bool) {
+	userID := middleware.GetUserID(r.Context())
+	endpoint, err := db.GetWebhookEndpoint(h.DB, userID, chi.URLParam(r, "id"))
+	if err != nil {
+		jsonError(w, "webhook-not-found", http.StatusNotFound)
+		return nil, false
+	}
+
+	delivery, err := db.GetWebhookDelivery(h.DB, endpoint.ID, chi.URLParam(r, "deliveryId"))
+	if err != nil {
+		jsonError(w, "delivery-not-found", http.StatusNotFound)
+		return nil, false
+	}
+	return delivery, true
+}
+
+func (h *WebhooksHandler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	delivery, ok := h.delivery(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delivery)
+}
+
+func (h *WebhooksHandler) ReplayDelivery(w http.ResponseWriter, r *http.Request) {
+	delivery, ok := h.delivery(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := h.Engine.ReplayWebhookDelivery(delivery)
+	if errors.Is(err, deploy.ErrWebhookEndpointDisabled) {
+		jsonError(w, "endpoint-disabled", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		jsonError(w, "replay-failed", http.StatusInternalServerError)
+		return
+	}
+
+	replayed, _ := db.GetWebhookDelivery(h.DB, delivery.EndpointID, id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(replayed)
+}
@@ -7,6 +7,7 @@ package lib
 import (
 	"crypto/tls"
 	"fmt"
+	"html"
 	"net/smtp"
 	"os"
 	"time"
@@ -125,6 +126,16 @@ func SendPasswordResetEmail(to, token, username string) error {
 	return SendEmail(to, subject, body)
 }
 
+func SendDeploymentNotificationEmail(to, subject, heading, message, logExcerpt, url string) error {
+	body := html.EscapeString(message)
+	if logExcerpt != "" {
+		body += `<br><br><span style="display: block; font-family: ui-monospace, Menlo, Consolas, monospace; font-size: 12px; text-align: left; white-space: pre-wrap; word-break: break-all;">` +
+			html.EscapeString(logExcerpt) + `</span>`
+	}
+	return SendEmail(to, subject, buildEmailTemplate(html.EscapeString(heading), body, "View deployment", url,
+		"You can change which notifications you receive in your account settings."))
+}
+
 func buildEmailTemplate(heading, message, buttonText, buttonURL, footer string) string {
 	brandName := "boop.cat"
 	return fmt.Sprintf(`<!DOCTYPE html>
@@ -6,6 +6,7 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -18,6 +19,7 @@ import (
 
 	"boop-cat/config"
 	"boop-cat/db"
+	"boop-cat/deploy"
 	"boop-cat/handlers"
 	"boop-cat/lib"
 	"boop-cat/middleware"
@@ -52,6 +54,7 @@ func main() {
 
 	r.Use(chimiddleware.Logger)
 	r.Use(chimiddleware.Recoverer)
+	r.Use(middleware.KeepPeerAddr)
 	r.Use(chimiddleware.RealIP)
 	r.Use(middleware.WithUser(database))
 	r.Use(middleware.RateLimit(100, 60*time.Second))
@@ -76,7 +79,52 @@ func main() {
 			cfg.DeliveryMode, cfg.EdgeRootDomain)
 	})
 
-	deployHandler := handlers.NewDeployHandler(database)
+	deployHandler := handlers.NewDeployHandler(database, cfg)
+
+	executor, err := deploy.NewExecutor(cfg.BuildSandbox, deploy.ResourceLimits{
+		MemoryMB:   cfg.BuildMemoryMB,
+		CPUSeconds: cfg.BuildCPUSeconds,
+		MaxPids:    cfg.BuildMaxPids,
+		Network:    cfg.BuildNetwork,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize build sandbox: %v\n", err)
+		os.Exit(1)
+	}
+	if executor.Name() == deploy.ExecutorUnsafeLocal {
+		log.Println("Warning: builds run without isolation (BUILD_SANDBOX=unsafe-local). Use BUILD_SANDBOX=bwrap in production.")
+	}
+	deployHandler.Engine.Executor = executor
+
+	storage, err := deploy.NewStorage(deploy.StorageConfig{
+		Backend:      cfg.StorageBackend,
+		B2KeyID:      cfg.B2KeyID,
+		B2AppKey:     cfg.B2AppKey,
+		B2BucketID:   cfg.B2BucketID,
+		B2BucketName: cfg.B2BucketName,
+		S3Endpoint:   cfg.S3Endpoint,
+		S3Region:     cfg.S3Region,
+		S3Bucket:     cfg.S3Bucket,
+		S3AccessKey:  cfg.S3AccessKey,
+		S3SecretKey:  cfg.S3SecretKey,
+		S3PathStyle:  cfg.S3PathStyle,
+		LocalDir:     cfg.StorageLocalDir,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize storage: %v\n", err)
+		os.Exit(1)
+	}
+	deployHandler.Engine.Storage = storage
+
+	router, err := deploy.NewRouter(cfg.RoutingBackend, database,
+		deploy.NewCloudflareClient(cfg.CFAccountID, cfg.CFKVNSID, cfg.CFAPIToken))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize routing: %v\n", err)
+		os.Exit(1)
+	}
+	deployHandler.Engine.Router = router
+	deployHandler.Engine.Start()
+	deployHandler.Engine.StartJanitor()
 
 	authHandler := handlers.NewAuthHandler(database, deployHandler.Engine)
 	r.Mount("/api/auth", authHandler.Routes())
@@ -93,8 +141,14 @@ func main() {
 
 	r.Mount("/api/account", handlers.NewAccountHandler(database).Routes())
 
+	r.Mount("/api/webhooks", handlers.NewWebhooksHandler(database, deployHandler.Engine).Routes())
+
 	cdHandler := handlers.NewCustomDomainHandler(database, deployHandler.Engine)
 
+	deployHooksHandler := handlers.NewDeployHooksHandler(database, deployHandler.Engine, cfg)
+
+	gitWebhooksHandler := handlers.NewGitWebhooksHandler(database, deployHandler.Engine)
+
 	r.Route("/api/sites", func(r chi.Router) {
 		r.Use(middleware.RequireLogin)
 
@@ -107,9 +161,30 @@ func main() {
 			r.Put("/settings", sitesHandler.UpdateSiteSettings)
 			r.Post("/settings", sitesHandler.UpdateSiteSettings)
 			r.Delete("/", sitesHandler.DeleteSite)
+			r.Get("/secret-env-keys", sitesHandler.GetSecretEnvKeys)
+			r.Put("/secret-env-keys", sitesHandler.UpdateSecretEnvKeys)
 
 			r.Post("/deploy", deployHandler.TriggerDeploy)
 			r.Get("/deployments", deployHandler.ListDeployments)
+			r.Post("/deployments/{id}/promote", deployHandler.PromoteDeployment)
+			r.Post("/deployments/{id}/pin", deployHandler.PinDeployment)
+			r.Delete("/deployments/{id}/pin", deployHandler.PinDeployment)
+			r.Post("/rollback", deployHandler.RollbackSite)
+			r.Get("/rollbacks", deployHandler.ListRollbacks)
+			r.Get("/previews", deployHandler.ListPreviews)
+			r.Put("/previews", deployHandler.UpdatePreviewSettings)
+			r.Post("/previews", deployHandler.CreatePreview)
+			r.Delete("/previews/{previewId}", deployHandler.DeletePreview)
+
+			r.Get("/deploy-hooks", deployHooksHandler.ListHooks)
+			r.Post("/deploy-hooks", deployHooksHandler.CreateHook)
+			r.Patch("/deploy-hooks/{hookId}", deployHooksHandler.RenameHook)
+			r.Delete("/deploy-hooks/{hookId}", deployHooksHandler.DeleteHook)
+			r.Get("/deploy-hooks/{hookId}/triggers", deployHooksHandler.ListTriggers)
+
+			r.Get("/git-webhook", gitWebhooksHandler.GetSettings)
+			r.Post("/git-webhook", gitWebhooksHandler.RotateSecret)
+			r.Delete("/git-webhook", gitWebhooksHandler.DisableWebhook)
 
 			r.Get("/custom-domains", cdHandler.ListCustomDomains)
 			r.Post("/custom-domains", cdHandler.CreateCustomDomain)
@@ -124,6 +199,8 @@ func main() {
 		r.Use(middleware.RequireLogin)
 		r.Get("/", deployHandler.GetDeployment)
 		r.Get("/logs", deployHandler.GetDeploymentLogs)
+		r.Get("/logs/stream", deployHandler.StreamDeploymentLogs)
+		r.Get("/files", deployHandler.GetDeploymentFiles)
 		r.Post("/stop", deployHandler.StopDeployment)
 	})
 
@@ -134,10 +211,14 @@ func main() {
 	ghWebhookHandler := handlers.NewGitHubWebhookHandler(database, deployHandler.Engine)
 	r.Mount("/api/github/webhook", ghWebhookHandler.Routes())
 
+	r.Mount("/api/git/webhook", gitWebhooksHandler.Routes())
+
+	r.Mount("/api/deploy-hooks", deployHooksHandler.Routes())
+
 	apiV1Handler := handlers.NewAPIV1Handler(database, deployHandler.Engine)
 	r.Mount("/api/v1", apiV1Handler.Routes())
 
-	adminHandler := handlers.NewAdminHandler(database)
+	adminHandler := handlers.NewAdminHandler(database, deployHandler.Engine)
 	r.Mount("/api/admin", adminHandler.Routes())
 
 	atprotoHandler := handlers.NewATProtoHandler(database)
@@ -162,9 +243,18 @@ func main() {
 		}))
 	}
 
+	var handler http.Handler = r
+	if cfg.SelfDeliveryEnabled() {
+		deliveryHandler := handlers.NewDeliveryHandler(deployHandler.Engine, cfg.EdgeRootDomain, os.Getenv("PUBLIC_URL"), cfg.TrustProxy)
+		handler = deliveryHandler.Wrap(r)
+		fmt.Printf("Serving deployed sites directly (FSD_DELIVERY=self, root domain %q)\n", cfg.EdgeRootDomain)
+	} else if cfg.DeliveryMode == "self" {
+		log.Println("Warning: FSD_DELIVERY=self requires FSD_EDGE_ROOT_DOMAIN; deployed sites will not be served")
+	}
+
 	addr := fmt.Sprintf(":%d", cfg.Port)
 	fmt.Printf("boop.cat (Go) listening on http://127.0.0.1%s\n", addr)
-	if err := http.ListenAndServe(addr, r); err != nil {
+	if err := http.ListenAndServe(addr, handler); err != nil {
 		fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
 		os.Exit(1)
 	}
@@ -5,6 +5,8 @@
 package middleware
 
 import (
+	"context"
+	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -56,6 +58,28 @@ var (
 	mu       sync.Mutex
 )
 
+const PeerAddrContextKey ContextKey = "peerAddr"
+
+// KeepPeerAddr records the connection's address before RealIP rewrites
+// RemoteAddr from forwarding headers.
+func KeepPeerAddr(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), PeerAddrContextKey, r.RemoteAddr)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func ClientIP(r *http.Request, trustProxy bool) string {
+	addr := r.RemoteAddr
+	if peer, ok := r.Context().Value(PeerAddrContextKey).(string); ok && !trustProxy {
+		addr = peer
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
 func RateLimit(requests int, window time.Duration) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 
@@ -78,3 +102,47 @@ func RateLimit(requests int, window time.Duration) func(http.Handler) http.Handl
 		})
 	}
 }
+
+type KeyedLimiter struct {
+	requests  int
+	window    time.Duration
+	visitors  map[string]*visitor
+	lastPrune time.Time
+	mu        sync.Mutex
+}
+
+func NewKeyedLimiter(requests int, window time.Duration) *KeyedLimiter {
+	return &KeyedLimiter{
+		requests:  requests,
+		window:    window,
+		visitors:  make(map[string]*visitor),
+		lastPrune: time.Now(),
+	}
+}
+
+func (k *KeyedLimiter) Allow(key string) bool {
+	now := time.Now()
+
+	k.mu.Lock()
+	if now.Sub(k.lastPrune) > k.window {
+		for key, v := range k.visitors {
+			if now.Sub(v.lastSeen) > k.window {
+				delete(k.visitors, key)
+			}
+		}
+		k.lastPrune = now
+	}
+	v, exists := k.visitors[key]
+	if !exists {
+		v = &visitor{limiter: newRateLimiter(k.requests, k.window)}
+		k.visitors[key] = v
+	}
+	v.lastSeen = now
+	k.mu.Unlock()
+
+	return v.limiter.Allow()
+}
+
+func (k *KeyedLimiter) Window() time.Duration {
+	return k.window
+}
@@ -3,7 +3,7 @@
 // See LICENSE file for details.
 
 import React, { useEffect, useMemo, useState } from 'react';
-import { useNavigate, useOutletContext, useParams } from 'react-router-dom';
+import { useNavigate, useOutletContext, useParams, useSearchParams } from 'react-router-dom';
 import {
   AlertTriangle,
   FolderX,
@@ -29,7 +29,9 @@ import {
   Play,
   Square,
   Github,
-  Globe
+  Globe,
+  Lock,
+  Unlock
 } from 'lucide-react';
 
 function Toast({ message, onClose }) {
@@ -249,8 +251,24 @@ function ErrorModal({ error, onClose }) {
   );
 }
 
+function groupLogStages(records) {
+  const groups = [];
+  for (const rec of records) {
+    const stage = rec.stage || 'setup';
+    let group = groups[groups.length - 1];
+    if (!group || group.stage !== stage) {
+      group = { key: `${stage}-${rec.n}`, stage, records: [], errors: 0, warnings: 0 };
+      groups.push(group);
+    }
+    group.records.push(rec);
+    if (rec.level === 'error') group.errors += 1;
+    if (rec.level === 'warn') group.warnings += 1;
+  }
+  return groups;
+}
+
 function LogsModal({ deployment, onClose }) {
-  const [logs, setLogs] = useState('');
+  const [records, setRecords] = useState([]);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState('');
 
@@ -258,12 +276,18 @@ function LogsModal({ deployment, onClose }) {
     if (!deployment) return;
 
     let cancelled = false;
-    let timer;
-    let lastText = null;
 
     const isTerminal = (status) => {
       const s = String(status || '').toLowerCase();
-      return s === 'active' || s === 'ready' || s === 'failed' || s === 'stopped' || s === 'canceled';
+      return (
+        s === 'active' ||
+        s === 'ready' ||
+        s === 'failed' ||
+        s === 'stopped' ||
+        s === 'canceled' ||
+        s === 'superseded' ||
+        s === 'expired'
+      );
     };
 
     const load = async ({ initial } = {}) => {
@@ -272,16 +296,13 @@ function LogsModal({ deployment, onClose }) {
           setLoading(true);
           setError('');
         }
-        const res = await fetch(`/api/deployments/${deployment.id}/logs`, {
+        const res = await fetch(`/api/deployments/${deployment.id}/logs?format=json`, {
           credentials: 'same-origin'
         });
-        const text = await res.text().catch(() => '');
-        if (!res.ok) throw new Error(text || 'Failed to fetch logs');
+        const data = await res.json().catch(() => null);
+        if (!res.ok || !data) throw new Error(data?.error || 'Failed to fetch logs');
         if (!cancelled) {
-          if (text !== lastText) {
-            setLogs(text);
-            lastText = text;
-          }
+          setRecords(data.records || []);
           if (initial) setLoading(false);
         }
       } catch (e) {
@@ -292,17 +313,43 @@ function LogsModal({ deployment, onClose }) {
       }
     };
 
-    load({ initial: true });
-    if (!isTerminal(deployment.status)) {
-      timer = window.setInterval(() => load({ initial: false }), 2500);
+    let source;
+    if (isTerminal(deployment.status) || typeof window.EventSource === 'undefined') {
+      load({ initial: true });
+    } else {
+      let received = [];
+      setRecords([]);
+      setLoading(true);
+      setError('');
+      source = new EventSource(`/api/deployments/${deployment.id}/logs/stream?format=json`, {
+        withCredentials: true
+      });
+      source.onopen = () => {
+        if (!cancelled) setLoading(false);
+      };
+      source.addEventListener('log', (e) => {
+        if (cancelled) return;
+        received = [...received, JSON.parse(e.data)];
+        setRecords(received);
+      });
+      source.addEventListener('end', () => {
+        source.close();
+      });
+      source.onerror = () => {
+        if (source.readyState === EventSource.CLOSED && !cancelled) {
+          load({ initial: false });
+        }
+      };
     }
 
     return () => {
       cancelled = true;
-      if (timer) window.clearInterval(timer);
+      if (source) source.close();
     };
   }, [deployment?.id]);
 
+  const groups = useMemo(() => groupLogStages(records), [records]);
+
   if (!deployment) return null;
 
   return (
@@ -321,10 +368,32 @@ function LogsModal({ deployment, onClose }) {
           <div className="logsInfo">
             <span className="badge">{deployment.status}</span>
             <span className="muted">{deployment.createdAt}</span>
+            <a className="muted" href={`/api/deployments/${deployment.id}/logs`} target="_blank" rel="noreferrer">
+              Raw logs
+            </a>
           </div>
           {loading && <div className="logsLoading">Loading logs...</div>}
           {error && <div className="error">{error}</div>}
-          {!loading && !error && <pre className="logsContent">{logs || 'No logs available'}</pre>}
+          {!loading && !error && (
+            <div className="logsContent">
+              {groups.length === 0 && 'No logs available'}
+              {groups.map((group, i) => (
+                <details key={group.key} className="logsStage" open={group.errors > 0 || i === groups.length - 1}>
+                  <summary>
+                    <span className="logsStageName">{group.stage}</span>
+                    <span className="muted">{group.records.length} lines</span>
+                    {group.errors > 0 && <span className="logsStageErrors">{group.errors} errors</span>}
+                    {group.warnings > 0 && <span className="logsStageWarnings">{group.warnings} warnings</span>}
+                  </summary>
+                  {group.records.map((rec) => (
+                    <div key={rec.n} className={`logsLine ${rec.level} ${rec.stream}`}>
+                      <span className="logsTime">{rec.ts}</span> {rec.text}
+                    </div>
+                  ))}
+                </details>
+              ))}
+            </div>
+          )}
         </div>
       </div>
     </div>
@@ -354,6 +423,7 @@ export default function DashboardSite() {
   const [deployError, setDeployError] = useState(null);
   const [deploying, setDeploying] = useState(false);
   const [logsDeployment, setLogsDeployment] = useState(null);
+  const [searchParams, setSearchParams] = useSearchParams();
   const [customDomains, setCustomDomains] = useState([]);
   const [customDomainInput, setCustomDomainInput] = useState('');
   const [customDomainLoading, setCustomDomainLoading] = useState(false);
@@ -363,6 +433,7 @@ export default function DashboardSite() {
   const [envModalOpen, setEnvModalOpen] = useState(false);
   const [editingEnv, setEditingEnv] = useState(null); // { key, value } for edit mode
   const [pollingDomains, setPollingDomains] = useState(new Set());
+  const [logRedaction, setLogRedaction] = useState({ secretEnvKeys: [], detectedEnvKeys: [] });
 
   const repoInfo = useMemo(() => {
     const gitUrl = site?.git?.url || '';
@@ -418,7 +489,9 @@ export default function DashboardSite() {
   };
 
   const activeDeployment = useMemo(() => {
-    return deployments.find((d) => d.status === 'building' || d.status === 'running') || null;
+    return (
+      deployments.find((d) => d.status === 'queued' || d.status === 'building' || d.status === 'running') || null
+    );
   }, [deployments]);
 
   const [config, setConfig] = useState({ deliveryMode: '', edgeRootDomain: '' });
@@ -484,6 +557,15 @@ export default function DashboardSite() {
     };
   }, [site?.id, activeDeployment?.status]);
 
+  useEffect(() => {
+    const logsId = searchParams.get('logs');
+    if (!logsId) return;
+    const match = deployments.find((d) => d.id === logsId);
+    if (!match) return;
+    setLogsDeployment(match);
+    setSearchParams({}, { replace: true });
+  }, [deployments, searchParams]);
+
   useEffect(() => {
     if (!site) return;
     (async () => {
@@ -496,6 +578,15 @@ export default function DashboardSite() {
     })();
   }, [site?.id]);
 
+  useEffect(() => {
+    if (!site) return;
+    api(`/api/sites/${encodeURIComponent(site.id)}/secret-env-keys`)
+      .then((d) =>
+        setLogRedaction({ secretEnvKeys: d?.secretEnvKeys || [], detectedEnvKeys: d?.detectedEnvKeys || [] })
+      )
+      .catch((e) => console.error('Failed to load log redaction settings:', e));
+  }, [site?.id, site?.envText]);
+
   useEffect(() => {
     api('/api/config')
       .then((d) => setConfig({ deliveryMode: d?.deliveryMode || '', edgeRootDomain: d?.edgeRootDomain || '' }))
@@ -539,6 +630,28 @@ export default function DashboardSite() {
     });
   };
 
+  const isDetectedSecretEnvKey = (key) => logRedaction.detectedEnvKeys.includes(key);
+  const isSecretEnvKey = (key) => isDetectedSecretEnvKey(key) || logRedaction.secretEnvKeys.includes(key);
+
+  const saveLogRedaction = async (next) => {
+    setError('');
+    try {
+      const data = await api(`/api/sites/${encodeURIComponent(site.id)}/secret-env-keys`, {
+        method: 'PUT',
+        body: JSON.stringify(next)
+      });
+      setLogRedaction((prev) => ({ ...prev, secretEnvKeys: data?.secretEnvKeys || [] }));
+    } catch (e) {
+      setError(e.message);
+    }
+  };
+
+  const toggleSecretEnvKey = (key) => {
+    const current = logRedaction.secretEnvKeys;
+    const next = current.includes(key) ? current.filter((k) => k !== key) : [...current, key];
+    saveLogRedaction({ secretEnvKeys: next });
+  };
+
   const openAddEnvModal = () => {
     setEditingEnv(null);
     setEnvModalOpen(true);
@@ -955,6 +1068,9 @@ export default function DashboardSite() {
                   <div className="muted">
                     Environment variables are encrypted and injected during the build process.
                   </div>
+                  <div className="muted envRedactionHint">
+                    Values of secret-looking keys are masked in build logs. Use the lock to mask any other key.
+                  </div>
                 </div>
 
                 {envEntries.filter((e) => e.key.trim()).length === 0 ? (
@@ -1009,6 +1125,20 @@ export default function DashboardSite() {
                               </div>
                             </div>
                             <div className="envTableCell envTableActions">
+                              <button
+                                className="envActionBtn"
+                                onClick={() => toggleSecretEnvKey(entry.key)}
+                                disabled={isDetectedSecretEnvKey(entry.key)}
+                                title={
+                                  isDetectedSecretEnvKey(entry.key)
+                                    ? 'Always masked in build logs'
+                                    : isSecretEnvKey(entry.key)
+                                      ? 'Masked in build logs'
+                                      : 'Shown in build logs'
+                                }
+                              >
+                                {isSecretEnvKey(entry.key) ? <Lock size={16} /> : <Unlock size={16} />}
+                              </button>
                               <button
                                 className="envActionBtn"
                                 onClick={() => toggleEnvVisibility(entry.key)}
@@ -2,6 +2,8 @@
 // Licensed under the Apache License, Version 2.0
 // See LICENSE file for details.
 
+const PREVIEW_SEPARATOR = '--';
+
 const ASSET_EXTENSIONS =
   /\.(js|mjs|css|png|jpg|jpeg|webp|avif|svg|gif|ico|woff|woff2|ttf|otf|eot|map|json|xml|txt|pdf|mp4|webm|mp3|wav)$/i;
 
@@ -76,6 +78,89 @@ async function fetchFromB2({ base, bucket, objectKey, acceptEncoding, authToken
   return fetch(url, { headers });
 }
 
+const MAX_CACHED_MANIFESTS = 256;
+const manifestCache = new Map();
+
+async function loadManifest({ base, bucket, siteId, deployId, authToken }) {
+  if (manifestCache.has(deployId)) return manifestCache.get(deployId);
+
+  const res = await fetchFromB2({
+    base,
+    bucket,
+    objectKey: `sites/${siteId}/manifests/${deployId}.json`,
+    authToken
+  });
+
+  let manifest = null;
+  if (res.ok) {
+    manifest = await res.json();
+  } else if (res.status !== 404) {
+    throw new Error(`manifest fetch failed (${res.status})`);
+  }
+
+  if (manifestCache.size >= MAX_CACHED_MANIFESTS) manifestCache.clear();
+  manifestCache.set(deployId, manifest);
+  return manifest;
+}
+
+const ENCODING_PREFERENCE = ['br', 'gzip'];
+
+function negotiateEncoding(acceptEncoding, encodings) {
+  if (!acceptEncoding || !encodings) return null;
+
+  const accepted = new Map();
+  for (const part of acceptEncoding.split(',')) {
+    const [name, ...params] = part.split(';').map((p) => p.trim());
+    if (!name) continue;
+    let q = 1;
+    for (const param of params) {
+      if (param.startsWith('q=')) {
+        const v = parseFloat(param.slice(2));
+        if (!Number.isNaN(v)) q = v;
+      }
+    }
+    accepted.set(name.toLowerCase(), q);
+  }
+
+  let best = null;
+  let bestQ = 0;
+  for (const enc of ENCODING_PREFERENCE) {
+    if (!encodings[enc]) continue;
+    const q = accepted.has(enc) ? accepted.get(enc) : accepted.get('*');
+    if (q !== undefined && q > bestQ) {
+      best = enc;
+      bestQ = q;
+    }
+  }
+  return best;
+}
+
+async function fetchPath({ manifest, keyPath, siteId, deployId, ...opts }) {
+  if (!manifest) {
+    return fetchFromB2({ ...opts, objectKey: `sites/${siteId}/${deployId}/${keyPath}` });
+  }
+
+  let filePath = keyPath;
+  try {
+    filePath = decodeURIComponent(keyPath);
+  } catch {}
+
+  const entry = manifest.files[filePath];
+  if (!entry) return new Response(null, { status: 404 });
+
+  const encoding = negotiateEncoding(opts.acceptEncoding, entry.encodings);
+  const hash = encoding ? entry.encodings[encoding].hash : entry.hash;
+
+  const res = await fetchFromB2({ ...opts, objectKey: `sites/${siteId}/blobs/${hash}` });
+  if (!res.ok) return res;
+
+  const headers = new Headers(res.headers);
+  if (entry.contentType) headers.set('content-type', entry.contentType);
+  headers.set('vary', 'Accept-Encoding');
+  if (encoding) headers.set('content-encoding', encoding);
+  return new Response(res.body, { status: res.status, headers });
+}
+
 export default {
   async fetch(request, env, ctx) {
     const url = new URL(request.url);
@@ -90,23 +175,28 @@ export default {
       return new Response('Service misconfigured', { status: 500 });
     }
 
-    let siteId = await ROUTING.get(`host:${hostname}`);
-    if (!siteId) {
-      const sub = parseSubdomain(hostname, ROOT_DOMAIN);
-      if (sub) siteId = await ROUTING.get(`host:${sub}`);
+    const sub = parseSubdomain(hostname, ROOT_DOMAIN);
+    let siteId = null;
+    let deployId = null;
+
+    siteId = await ROUTING.get(`host:${hostname}`);
+    if (!siteId && sub) siteId = await ROUTING.get(`host:${sub}`);
+
+    if (siteId) {
+      deployId = await ROUTING.get(`current:${siteId}`);
+    } else if (sub && sub.includes(PREVIEW_SEPARATOR)) {
+      const preview = await ROUTING.get(`preview:${sub}`);
+      if (preview) [siteId, deployId] = preview.split(':');
     }
     if (!siteId) {
       return new Response('Site not found', { status: 404 });
     }
-
-    const deployId = await ROUTING.get(`current:${siteId}`);
     if (!deployId) {
       return new Response('No deployment found', { status: 404 });
     }
 
     const pathname = url.pathname;
     const keyPath = pathname.replace(/^\//, '') || 'index.html';
-    const basePath = `sites/${siteId}/${deployId}`;
     const acceptEncoding = request.headers.get('accept-encoding');
 
     let authToken = null;
@@ -118,39 +208,21 @@ export default {
       base = auth.downloadUrl;
     }
 
-    let res = await fetchFromB2({
-      base,
-      bucket: B2_BUCKET_NAME,
-      objectKey: `${basePath}/${keyPath}`,
-      acceptEncoding,
-      authToken
-    });
+    const manifest = await loadManifest({ base, bucket: B2_BUCKET_NAME, siteId, deployId, authToken });
+    const opts = { base, bucket: B2_BUCKET_NAME, acceptEncoding, authToken, manifest, siteId, deployId };
+
+    let res = await fetchPath({ ...opts, keyPath });
 
     if (res.status === 404 && isAssetPath(pathname)) {
       const rewritten = stripFirstSegment(pathname);
       if (rewritten !== pathname) {
-        const rewrittenKey = rewritten.replace(/^\//, '');
-        res = await fetchFromB2({
-          base,
-          bucket: B2_BUCKET_NAME,
-          objectKey: `${basePath}/${rewrittenKey}`,
-          acceptEncoding,
-          authToken
-        });
+        res = await fetchPath({ ...opts, keyPath: rewritten.replace(/^\//, '') });
       }
     }
 
     if (res.status === 404 && !isAssetPath(pathname)) {
-      const dirPath = pathname.endsWith('/') ? pathname : `${pathname}/`;
       const dirKey = `${keyPath.replace(/\/$/, '')}/index.html`;
-
-      const dirRes = await fetchFromB2({
-        base,
-        bucket: B2_BUCKET_NAME,
-        objectKey: `${basePath}/${dirKey}`,
-        acceptEncoding,
-        authToken
-      });
+      const dirRes = await fetchPath({ ...opts, keyPath: dirKey });
 
       if (dirRes.ok) {
         res = dirRes;
@@ -158,13 +230,7 @@ export default {
     }
 
     if (res.status === 404 && !isAssetPath(pathname)) {
-      res = await fetchFromB2({
-        base,
-        bucket: B2_BUCKET_NAME,
-        objectKey: `${basePath}/index.html`,
-        acceptEncoding,
-        authToken
-      });
+      res = await fetchPath({ ...opts, keyPath: 'index.html' });
     }
 
     if (!res.ok) {
@@ -186,6 +252,10 @@ export default {
     headers.delete('x-bz-upload-timestamp');
     headers.delete('x-bz-info-src_last_modified_millis');
 
-    return new Response(res.body, { status: 200, headers });
+    return new Response(res.body, {
+      status: 200,
+      headers,
+      encodeBody: headers.has('content-encoding') ? 'manual' : 'automatic'
+    });
   }
 };